@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/diff"
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// runApplyCommand handles `mkproj apply` and returns the exit code. It
+// prints the plan, asks for confirmation unless --yes is given, then applies
+// it.
+func runApplyCommand(args []string) int {
+	applyFlags := flag.NewFlagSet("apply", flag.ExitOnError)
+	fileFlag := applyFlags.String("file", "", "Structure file to apply (default: stdin)")
+	rootFlag := applyFlags.String("root", ".", "Directory to bring up to date")
+	formatFlag := applyFlags.String("format", "auto", "Structure format: auto, dash, indent, tree, yaml or json")
+	pruneFlag := applyFlags.Bool("prune", false, "Delete entries the structure does not declare and replace entries of the wrong kind")
+	yesFlag := applyFlags.Bool("yes", false, "Apply the plan without asking for confirmation")
+	dryRunFlag := applyFlags.Bool("dry-run", false, "Print the plan without applying it")
+	noManifestFlag := applyFlags.Bool("no-manifest", false, "Do not record the changes in .mkproj/manifest.json for 'undo'")
+	varsFileFlag := applyFlags.String("vars", "", "File with key=value template variables")
+	applyFlags.Var(vars, "var", "Template variable as key=value (repeatable)")
+	applyFlags.Parse(args)
+
+	format, err := spec.ParseFormat(*formatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	if *varsFileFlag != "" {
+		if err := vars.LoadFile(*varsFileFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading variables file %s: %v\n", *varsFileFlag, err)
+			return exitInput
+		}
+	}
+	lines, format, err := readStructureLines(*fileFlag, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitInput
+	}
+	// Content sources are relative to the structure file
+	opts := project.Options{Format: format, Manifest: !*noManifestFlag, Vars: vars}
+	if *fileFlag != "" {
+		opts.BaseDir = filepath.Dir(*fileFlag)
+	}
+
+	plan, err := project.PlanApply(lines, *rootFlag, opts, *pruneFlag)
+	if err == nil && *pruneFlag && plan.RootExists {
+		err = planDeletions(plan, lines, format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCode(err)
+	}
+	plan.Print(os.Stdout)
+	if plan.Empty() || *dryRunFlag {
+		return exitOK
+	}
+	if !*yesFlag {
+		approved, err := confirm("Apply these changes?")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v; use --yes to apply without asking\n", err)
+			return exitError
+		}
+		if !approved {
+			fmt.Println("Nothing was changed.")
+			return exitOK
+		}
+	}
+	if err := project.Apply(plan); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// planDeletions adds the entries of the root that the structure does not
+// declare to plan. Ignored entries and the manifest are never deleted.
+func planDeletions(plan *project.ApplyPlan, lines []string, format spec.Format) error {
+	nodes, err := spec.ParseAs(lines, format)
+	if err != nil {
+		return err
+	}
+	opts := tree.ScanOptions{ShowHidden: true, Ignore: true, Exclude: []string{project.ManifestDir}}
+	diffs, err := diff.Compare(nodes, plan.Root, opts)
+	if err != nil {
+		return &project.RootError{Path: plan.Root, Err: err}
+	}
+	var extra []string
+	for _, d := range diffs {
+		if d.Status == diff.Extra {
+			extra = append(extra, d.Path)
+		}
+	}
+	plan.Delete(extra)
+	return nil
+}
+
+// confirm asks a yes or no question on the terminal. Anything but "y" or
+// "yes" is a no.
+func confirm(question string) (bool, error) {
+	in, err := terminalInput()
+	if err != nil {
+		return false, fmt.Errorf("cannot ask for confirmation without a terminal: %w", err)
+	}
+	defer in.Close()
+	fmt.Printf("\n%s [y/N] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("no answer: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// stringsFlag collects the values of a repeatable flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// runCaptureCommand handles `mkproj capture` and returns the exit code.
+func runCaptureCommand(args []string) int {
+	captureFlags := flag.NewFlagSet("capture", flag.ExitOnError)
+	rootFlag := captureFlags.String("root", ".", "Directory to capture")
+	outFlag := captureFlags.String("out", "", "Structure file to write (default: stdout)")
+	contentFlag := captureFlags.Bool("content", false, "Inline the content of text files")
+	allFlag := captureFlags.Bool("all", false, "Include hidden files and directories")
+	allFlagShort := captureFlags.Bool("a", false, "Include hidden files and directories (shorthand)")
+	noIgnoreFlag := captureFlags.Bool("no-ignore", false, "Capture entries matched by .gitignore and .mkprojignore files")
+	followFlag := captureFlags.Bool("follow-symlinks", false, "Capture what symlinks point to instead of the links")
+	var excludeFlag, includeFlag stringsFlag
+	captureFlags.Var(&excludeFlag, "exclude", "Glob pattern of entries to leave out (repeatable)")
+	captureFlags.Var(&includeFlag, "include", "Glob pattern of entries to capture even if hidden, excluded or ignored (repeatable)")
+	captureFlags.Parse(args)
+
+	opts := tree.CaptureOptions{
+		ScanOptions: tree.ScanOptions{
+			ShowHidden:     *allFlag || *allFlagShort,
+			Ignore:         !*noIgnoreFlag,
+			Exclude:        excludeFlag,
+			Include:        includeFlag,
+			FollowSymlinks: *followFlag,
+		},
+		Contents: *contentFlag,
+	}
+
+	// The manifest describes this directory as it was created, not as it is
+	opts.Exclude = append(opts.Exclude, project.ManifestDir)
+
+	var out io.Writer = os.Stdout
+	if *outFlag != "" {
+		file, err := os.Create(*outFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file %s: %v\n", *outFlag, err)
+			return exitError
+		}
+		defer file.Close()
+		out = file
+		// Never capture the file being written
+		if rel, ok := relativeTo(*rootFlag, *outFlag); ok {
+			opts.Exclude = append(opts.Exclude, rel)
+		}
+	}
+
+	skipped, err := tree.Capture(out, *rootFlag, opts)
+	for _, entry := range skipped {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", entry.Path, entry.Reason)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error capturing %s: %v\n", *rootFlag, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// relativeTo returns path relative to root, slash-separated, when path is
+// inside root.
+func relativeTo(root, path string) (string, bool) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/rules"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// runCheckCommand handles `mkproj check` and returns the exit code: exitOK
+// when every rule passes and exitCheck when some are broken.
+func runCheckCommand(args []string) int {
+	checkFlags := flag.NewFlagSet("check", flag.ExitOnError)
+	rulesFlag := checkFlags.String("rules", "", "Rule file to check the directory against")
+	rootFlag := checkFlags.String("root", ".", "Directory to check")
+	outputFlag := checkFlags.String("output", "text", "Report format: text or json")
+	noIgnoreFlag := checkFlags.Bool("no-ignore", false, "Check entries matched by .gitignore and .mkprojignore files too")
+	var excludeFlag stringsFlag
+	checkFlags.Var(&excludeFlag, "exclude", "Glob pattern of entries to leave out of every rule (repeatable)")
+	checkFlags.Parse(args)
+
+	if *rulesFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: no rule file given, use --rules")
+		return exitUsage
+	}
+	if *outputFlag != "text" && *outputFlag != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output %q, expected text or json\n", *outputFlag)
+		return exitUsage
+	}
+	ruleSet, err := rules.Load(*rulesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading rule file: %v\n", err)
+		return exitInput
+	}
+	opts := tree.ScanOptions{
+		ShowHidden: true,
+		Ignore:     !*noIgnoreFlag,
+		Exclude:    append(excludeFlag, project.ManifestDir),
+	}
+	violations, err := rules.Check(ruleSet, *rootFlag, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *rootFlag, err)
+		return exitRoot
+	}
+
+	if *outputFlag == "json" {
+		err = rules.WriteJSON(os.Stdout, *rootFlag, ruleSet, violations)
+	} else {
+		err = rules.WriteText(os.Stdout, ruleSet, violations)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if len(violations) > 0 {
+		return exitCheck
+	}
+	return exitOK
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jobehi/mkproj/internal/diff"
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// runDiffCommand handles `mkproj diff` and returns the exit code: exitOK
+// when the directory matches the structure and exitDiff when it does not.
+func runDiffCommand(args []string) int {
+	diffFlags := flag.NewFlagSet("diff", flag.ExitOnError)
+	fileFlag := diffFlags.String("file", "", "Structure file to compare with (default: stdin)")
+	rootFlag := diffFlags.String("root", ".", "Directory to compare")
+	formatFlag := diffFlags.String("format", "auto", "Structure format: auto, dash, indent, tree, yaml or json")
+	outputFlag := diffFlags.String("output", "text", "Report format: text or json")
+	colorFlag := diffFlags.String("color", "auto", "Color the text report: auto, always or never")
+	noIgnoreFlag := diffFlags.Bool("no-ignore", false, "Report entries matched by .gitignore and .mkprojignore files as extra")
+	varsFileFlag := diffFlags.String("vars", "", "File with key=value template variables")
+	var excludeFlag stringsFlag
+	diffFlags.Var(&excludeFlag, "exclude", "Glob pattern of entries never reported as extra (repeatable)")
+	diffFlags.Var(vars, "var", "Template variable as key=value (repeatable)")
+	diffFlags.Parse(args)
+
+	format, err := spec.ParseFormat(*formatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	if *outputFlag != "text" && *outputFlag != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output %q, expected text or json\n", *outputFlag)
+		return exitUsage
+	}
+	color, err := useColor(*colorFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	if *varsFileFlag != "" {
+		if err := vars.LoadFile(*varsFileFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading variables file %s: %v\n", *varsFileFlag, err)
+			return exitInput
+		}
+	}
+
+	nodes, err := readStructure(*fileFlag, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitInput
+	}
+	opts := tree.ScanOptions{
+		ShowHidden: true,
+		Ignore:     !*noIgnoreFlag,
+		// The manifest records how the directory was created, it is not part of it
+		Exclude: append(excludeFlag, project.ManifestDir),
+	}
+	diffs, err := diff.Compare(nodes, *rootFlag, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *rootFlag, err)
+		return exitRoot
+	}
+
+	if *outputFlag == "json" {
+		err = diff.WriteJSON(os.Stdout, *rootFlag, diffs)
+	} else {
+		err = diff.WriteText(os.Stdout, diffs, color)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if len(diffs) > 0 {
+		return exitDiff
+	}
+	return exitOK
+}
+
+// readStructure reads and parses the structure in path, or in piped input
+// when path is empty, after rendering template variables. The format is
+// detected from the file name when it is auto.
+func readStructure(path string, format spec.Format) ([]*spec.Node, error) {
+	lines, format, err := readStructureLines(path, format)
+	if err != nil {
+		return nil, err
+	}
+	return spec.ParseAs(lines, format)
+}
+
+// readStructureLines reads the structure in path, or in piped input when
+// path is empty, and renders its template variables. It returns the format
+// to parse it with, detected from the file name when format is auto.
+func readStructureLines(path string, format spec.Format) ([]string, spec.Format, error) {
+	in := os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, format, err
+		}
+		defer file.Close()
+		in = file
+		if format == spec.FormatAuto {
+			format = spec.FormatForPath(path)
+		}
+	} else if !isPipedInput() {
+		return nil, format, fmt.Errorf("no structure given, use --file or pipe one in")
+	}
+	lines, err := readLines(in)
+	if err != nil {
+		return nil, format, err
+	}
+	lines, err = render.Lines(lines, vars)
+	return lines, format, err
+}
+
+// useColor decides whether to color output written to stdout, from the
+// value of a --color flag. Under auto, colors are used on a terminal unless
+// the NO_COLOR environment variable is set.
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("unknown color mode %q, expected auto, always or never", mode)
+}
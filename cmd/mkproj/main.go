@@ -2,25 +2,56 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/jobehi/mkproj/internal/editor"
 	"github.com/jobehi/mkproj/internal/project"
-	"github.com/jobehi/mkproj/internal/tree"
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/spec"
 	"github.com/rivo/tview"
 )
 
 var rootDir string
 var inputFile string
+var dryRun bool
+var atomic bool
+var manifest bool
+var onConflict project.ConflictPolicy
+var vars = render.Vars{}
+
+// Exit codes reported to the shell so scripts can tell failures apart.
+const (
+	exitOK       = 0
+	exitError    = 1 // unexpected failure, e.g. the interactive UI crashed
+	exitUsage    = 2 // invalid flags or arguments, as the flag package reports them
+	exitInput    = 3 // the structure could not be read or parsed
+	exitRoot     = 4 // the root directory could not be created
+	exitPartial  = 5 // some entries of the structure failed
+	exitConflict = 6 // existing entries are in the way and --on-conflict=fail
+	exitDiff     = 7 // the directory differs from the structure (diff)
+	exitCheck    = 8 // the directory breaks layout rules (check)
+)
 
 func main() {
 	// Parse flags but not immediately
 	rootFlag := flag.String("root", ".", "Root directory for project structure")
 	fileFlag := flag.String("file", "", "Input file with project structure")
+	templateFlag := flag.String("template", "", "Name of a stored template to create")
+	formatFlag := flag.String("format", "auto", "Structure format: auto, dash, indent, tree, yaml or json")
+	dryRunFlag := flag.Bool("dry-run", false, "Print the planned operations without creating anything")
+	atomicFlag := flag.Bool("atomic", false, "Leave nothing behind if any entry fails")
+	noManifestFlag := flag.Bool("no-manifest", false, "Do not record the created entries in .mkproj/manifest.json for 'undo'")
+	onConflictFlag := flag.String("on-conflict", "skip", "What to do about existing entries in the way: skip, overwrite, fail, backup or prompt")
+	varsFileFlag := flag.String("vars", "", "File with key=value template variables")
+	flag.Var(vars, "var", "Template variable as key=value (repeatable)")
 	flag.Usage = printHelp
 
 	// Parse the command (e.g., "tree", "create", etc.)
@@ -31,10 +62,64 @@ func main() {
 
 	command := os.Args[1]
 	args := os.Args[2:]
+
+	// Handle tree command
+	if command == "tree" {
+		os.Exit(runTreeCommand(args))
+	}
+
+	// Handle capture command
+	if command == "capture" {
+		os.Exit(runCaptureCommand(args))
+	}
+
+	// Handle diff command
+	if command == "diff" {
+		os.Exit(runDiffCommand(args))
+	}
+
+	// Handle apply command
+	if command == "apply" {
+		os.Exit(runApplyCommand(args))
+	}
+
+	// Handle check command
+	if command == "check" {
+		os.Exit(runCheckCommand(args))
+	}
+
+	// Handle undo command
+	if command == "undo" || command == "clean" {
+		os.Exit(runUndoCommand(args))
+	}
+
+	// Handle template command, which has its own subcommands and flags
+	if command == "template" {
+		os.Exit(runTemplateCommand(args))
+	}
+
 	flag.CommandLine.Parse(args) // Parse the flags after the command
 
 	rootDir = *rootFlag
 	inputFile = *fileFlag
+	dryRun = *dryRunFlag
+	atomic = *atomicFlag
+	manifest = !*noManifestFlag
+	format, err := spec.ParseFormat(*formatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if onConflict, err = project.ParseConflictPolicy(*onConflictFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if *varsFileFlag != "" {
+		if err := vars.LoadFile(*varsFileFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading variables file %s: %v\n", *varsFileFlag, err)
+			os.Exit(exitInput)
+		}
+	}
 
 	// Handle help command
 	if command == "help" {
@@ -42,53 +127,53 @@ func main() {
 		return
 	}
 
-	// Handle tree command
-	if command == "tree" {
-		treeFlags := flag.NewFlagSet("tree", flag.ExitOnError)
-		allFlag := treeFlags.Bool("all", false, "Include hidden files and directories")
-		allFlagShort := treeFlags.Bool("a", false, "Include hidden files and directories (shorthand)")
-		rootFlag := treeFlags.String("root", ".", "Root directory for project structure")
-		treeFlags.Parse(args)
-
-		rootDir = *rootFlag
-		showHidden := *allFlag || *allFlagShort
-
-		tree.DisplayDirectoryTree(rootDir, showHidden)
-		return
-	}
-
 	// Handle create command
 	if command == "create" {
+		if *templateFlag != "" {
+			// Read from the template store
+			structure, opts, err := loadTemplate(*templateFlag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading template %s: %v\n", *templateFlag, err)
+				os.Exit(exitInput)
+			}
+			if format != spec.FormatAuto {
+				opts.Format = format
+			}
+			exitOnError(createStructure(structure, opts))
+			return
+		}
+
 		if inputFile != "" {
 			// Read from input file
 			file, err := os.Open(inputFile)
 			if err != nil {
-				fmt.Printf("Error reading input file %s: %v\n", inputFile, err)
-				return
+				fmt.Fprintf(os.Stderr, "Error reading input file %s: %v\n", inputFile, err)
+				os.Exit(exitInput)
 			}
 			defer file.Close()
 
-			scanner := bufio.NewScanner(file)
-			var structure []string
-			for scanner.Scan() {
-				structure = append(structure, scanner.Text())
+			structure, err := readLines(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading input file %s: %v\n", inputFile, err)
+				os.Exit(exitInput)
+			}
+			if format == spec.FormatAuto {
+				format = spec.FormatForPath(inputFile)
 			}
-			project.BuildProjectStructure(structure, rootDir)
+			// Content sources are relative to the structure file
+			exitOnError(createStructure(structure, project.Options{BaseDir: filepath.Dir(inputFile), Format: format}))
 			return
 		}
 
 		// Handle piped input
 		if isPipedInput() {
-			reader := bufio.NewReader(os.Stdin)
-			var structure []string
-			for {
-				line, err := reader.ReadString('\n')
-				if err != nil {
-					break
-				}
-				structure = append(structure, strings.TrimSpace(line))
+			// Lines keep their indentation, it matters inside content blocks
+			structure, err := readLines(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading piped input: %v\n", err)
+				os.Exit(exitInput)
 			}
-			project.BuildProjectStructure(structure, rootDir)
+			exitOnError(createStructure(structure, project.Options{Format: format}))
 			return
 		}
 	}
@@ -97,6 +182,129 @@ func main() {
 	runInteractiveMode(rootDir)
 }
 
+// parseArgs parses flags that may appear before, between or after positional
+// arguments, and returns the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// readLines reads every line of r without its line ending
+func readLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// createStructure renders template variables into the structure and its
+// content sources, then builds it, or only prints its plan in dry-run mode
+func createStructure(structure []string, opts project.Options) error {
+	structure, err := render.Lines(structure, vars)
+	if err != nil {
+		return err
+	}
+	opts.Vars = vars
+	if dryRun {
+		plan, err := project.PlanProjectStructure(structure, rootDir, opts)
+		if err != nil {
+			return err
+		}
+		plan.Print(os.Stdout)
+		return nil
+	}
+	opts.OnConflict = onConflict
+	opts.Atomic = atomic
+	opts.Manifest = manifest
+	opts.Prompt = promptConflict
+	return project.BuildProjectStructure(structure, rootDir, opts)
+}
+
+// promptConflict asks on the terminal how to resolve a conflict.
+func promptConflict(conflict project.Conflict) (project.ConflictPolicy, error) {
+	in, err := terminalInput()
+	if err != nil {
+		return "", fmt.Errorf("cannot ask about the conflict without a terminal: %w", err)
+	}
+	defer in.Close()
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Printf("%s: %s. [s]kip, [o]verwrite or [b]ack up? ", conflict.Path, conflict.Reason)
+		answer, err := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "s", "skip":
+			return project.ConflictSkip, nil
+		case "o", "overwrite":
+			return project.ConflictOverwrite, nil
+		case "b", "backup":
+			return project.ConflictBackup, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("no answer about the conflict: %w", err)
+		}
+	}
+}
+
+// terminalInput returns where to read the user's answers from. Piped input
+// holds the structure, so answers are read from the terminal device instead
+// of stdin in that case.
+func terminalInput() (io.ReadCloser, error) {
+	if !isPipedInput() {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(terminalPath())
+}
+
+// terminalPath is the device the user's terminal can be read from.
+func terminalPath() string {
+	if runtime.GOOS == "windows" {
+		return "CONIN$"
+	}
+	return "/dev/tty"
+}
+
+// exitCode maps an error returned while building to the process exit code.
+func exitCode(err error) int {
+	var renderErr *render.Error
+	var parseErr spec.ErrorList
+	var sourceErr *project.SourceError
+	var rootErr *project.RootError
+	var buildErr *project.BuildError
+	var conflictErr *project.ConflictError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &renderErr), errors.As(err, &parseErr), errors.As(err, &sourceErr):
+		return exitInput
+	case errors.As(err, &rootErr):
+		return exitRoot
+	case errors.As(err, &buildErr):
+		return exitPartial
+	case errors.As(err, &conflictErr):
+		return exitConflict
+	}
+	return exitError
+}
+
+// exitOnError reports err on stderr and exits with the matching code.
+func exitOnError(err error) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
 // isPipedInput detects if there is piped input from stdin
 func isPipedInput() bool {
 	info, err := os.Stdin.Stat()
@@ -118,12 +326,13 @@ func runInteractiveMode(rootDir string) {
 		SetText(fmt.Sprintf("Root Directory: %s\n", rootDir) +
 			"Welcome to mkproj\n" +
 			"Enter your project structure below.\n" +
-			"Use tabs for depth and filename:file for files without extensions.\n" +
+			"Use tabs for depth, filename:file for files without extensions and name/ for directories with dots.\n" +
 			"Press F2 to save and create the structure, Esc to quit.").
 		SetDynamicColors(true)
 
 	// Create the editor
 	ed := editor.NewEditor(statusBar)
+	var buildErr error
 
 	// Capture inputs like F2 (save) and Esc (exit)
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -134,7 +343,7 @@ func runInteractiveMode(rootDir string) {
 				return nil
 			}
 			app.Stop()
-			project.BuildProjectStructure(ed.Lines, rootDir)
+			buildErr = createStructure(ed.Lines, project.Options{Format: spec.FormatDash})
 			return nil
 		case tcell.KeyEsc:
 			app.Stop()
@@ -152,8 +361,9 @@ func runInteractiveMode(rootDir string) {
 	// Run the interactive mode application
 	if err := app.SetRoot(layout, true).Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running application: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
+	exitOnError(buildErr)
 }
 
 func printHelp() {
@@ -163,13 +373,38 @@ Usage:
   mkproj [command] [options]
 
 Commands:
-  create       Create a project structure from a text file or piped input
-  tree         Display the current directory structure
+  create       Create a project structure from a text file, piped input or a stored template
+  tree         Display the current directory structure (--format=dash|ascii|json|yaml|markdown|html)
+  capture      Write a structure file that recreates an existing directory
+  template     Manage stored templates (add, list, show, remove)
+  apply        Bring a directory up to date with a structure file, after confirming the plan (--prune, --yes)
+  diff         Compare a structure file with an existing directory (--output=text|json)
+  check        Check a directory against the layout rules of a rule file (--output=text|json)
+  undo         Remove what 'create' recorded in .mkproj/manifest.json, unless it was modified (alias: clean)
   help         Display this help message
 
 Options:
-  --root=<path>    Specify the root directory for your project structure (default is current directory)
-  --file=<path>    Provide a file that contains the project structure (used with 'create')
+  --root=<path>       Specify the root directory for your project structure (default is current directory)
+  --file=<path>       Provide a file that contains the project structure (used with 'create')
+  --template=<name>   Use a stored template as the project structure (used with 'create')
+  --format=<name>     Structure format: auto (default), dash, indent, tree, yaml or json
+  --dry-run           Print what 'create' would do without touching the filesystem
+  --atomic            Undo everything if any entry fails, so a failed 'create' leaves nothing behind
+  --no-manifest       Do not record what 'create' made in .mkproj/manifest.json, which 'undo' reads
+  --on-conflict=<p>   What to do about existing entries in the way: skip (default), overwrite, fail, backup or prompt
+  --var=<k=v>         Set a template variable used by {{.k}} placeholders (repeatable)
+  --vars=<path>       Read template variables from a file of key=value lines
+
+Exit Codes:
+  0  Success
+  1  Unexpected error
+  2  Invalid command line flags or arguments
+  3  The project structure could not be read or parsed
+  4  The root directory could not be created
+  5  One or more entries could not be created, or 'undo' kept modified entries
+  6  Existing entries are in the way and --on-conflict=fail was given
+  7  The directory differs from the structure ('diff')
+  8  The directory breaks layout rules ('check')
 
 Interactive Mode:
   By default, mkproj starts in interactive mode where you can manually build your project structure.
@@ -184,9 +419,37 @@ Examples:
   # Create a project structure from a text file
   mkproj create --file=structure.txt --root=./new_project
 
+  # Preview the directories and files a structure would create
+  mkproj create --file=structure.txt --root=./new_project --dry-run
+
+  # Create a service from a structure with {{.Name}} placeholders
+  mkproj create --file=service.txt --root=./billing --var Name=billing
+
+  # Store a structure as a template and create a project from it
+  mkproj template add go-service --file=structure.txt
+  mkproj create --template=go-service --root=./billing
+
+  # Preview, confirm and apply the changes that make a directory match a structure
+  mkproj apply --file=layout.txt --root=./repo --prune
+
+  # Check that a repository still follows a standard layout, as JSON for CI
+  mkproj diff --file=layout.txt --root=./repo --output=json
+
+  # Enforce layout rules in CI
+  mkproj check --rules=layout.rules.yaml --root=./repo --output=json
+
+  # Remove what the last create added, keeping anything modified since
+  mkproj undo --root=./new_project
+
+  # Capture an existing project, with file contents, as a structure file
+  mkproj capture --root=./my_project --out=structure.txt --content
+
   # Display the current directory tree without hidden files
   mkproj tree --root=./my_project
 
   # Display the current directory tree including hidden files
-  mkproj tree --root=./my_project --all`)
+  mkproj tree --root=./my_project --all
+
+  # Print the tree as a Markdown list for a README
+  mkproj tree --root=./my_project --format=markdown`)
 }
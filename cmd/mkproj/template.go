@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/store"
+)
+
+// runTemplateCommand handles `mkproj template add|list|show|remove` and
+// returns the exit code.
+func runTemplateCommand(args []string) int {
+	if len(args) == 0 {
+		printTemplateHelp()
+		return exitUsage
+	}
+	templates, err := store.Default()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locating template store: %v\n", err)
+		return exitError
+	}
+
+	subcommand := args[0]
+	flags := flag.NewFlagSet("template "+subcommand, flag.ExitOnError)
+	fileFlag := flags.String("file", "", "File with the project structure to store (default: stdin)")
+	forceFlag := flags.Bool("force", false, "Replace an existing template with the same name")
+	formatFlag := flags.String("format", "", "Format of the structure to store: yaml or json for piped documents (default: from the --file extension)")
+	flags.Usage = printTemplateHelp
+	names := parseArgs(flags, args[1:])
+
+	switch subcommand {
+	case "list":
+		list, err := templates.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing templates: %v\n", err)
+			return exitError
+		}
+		for _, name := range list {
+			fmt.Println(name)
+		}
+		return exitOK
+	case "add", "show", "remove":
+		if len(names) != 1 {
+			fmt.Fprintf(os.Stderr, "Usage: mkproj template %s <name>\n", subcommand)
+			return exitUsage
+		}
+	default:
+		printTemplateHelp()
+		return exitUsage
+	}
+
+	name := names[0]
+	switch subcommand {
+	case "add":
+		ext := filepath.Ext(*fileFlag)
+		switch format, err := spec.ParseFormat(*formatFlag); {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitUsage
+		case format == spec.FormatYAML || format == spec.FormatJSON:
+			ext = "." + string(format)
+		case format != spec.FormatAuto:
+			ext = ""
+		}
+		data, err := readTemplateSource(*fileFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading structure: %v\n", err)
+			return exitInput
+		}
+		err = templates.Add(name, data, ext, *forceFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding template %s: %v\n", name, err)
+			return exitError
+		}
+		fmt.Printf("Added template %s\n", name)
+	case "show":
+		data, err := templates.Get(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading template %s: %v\n", name, err)
+			return exitError
+		}
+		os.Stdout.Write(data)
+	case "remove":
+		if err := templates.Remove(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing template %s: %v\n", name, err)
+			return exitError
+		}
+		fmt.Printf("Removed template %s\n", name)
+	}
+	return exitOK
+}
+
+// readTemplateSource reads the structure to store from path, or from piped
+// input when path is empty.
+func readTemplateSource(path string) ([]byte, error) {
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	if !isPipedInput() {
+		return nil, fmt.Errorf("provide --file or pipe the structure on stdin")
+	}
+	return io.ReadAll(os.Stdin)
+}
+
+// loadTemplate reads a stored template as structure lines, in the format it
+// was stored in. Content sources in the template are resolved against the
+// store directory.
+func loadTemplate(name string) ([]string, project.Options, error) {
+	templates, err := store.Default()
+	if err != nil {
+		return nil, project.Options{}, err
+	}
+	path, err := templates.Path(name)
+	if err != nil {
+		return nil, project.Options{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, project.Options{}, err
+	}
+	lines, err := readLines(bytes.NewReader(data))
+	return lines, project.Options{BaseDir: templates.Dir, Format: spec.FormatForPath(path)}, err
+}
+
+func printTemplateHelp() {
+	fmt.Println(`Usage:
+  mkproj template add <name> [--file=<path>] [--format=yaml|json] [--force]
+  mkproj template list
+  mkproj template show <name>
+  mkproj template remove <name>
+
+Templates are stored in $XDG_CONFIG_HOME/mkproj/templates (or the platform
+config directory) and used with 'mkproj create --template=<name>'.`)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// runTreeCommand handles `mkproj tree` and returns the exit code.
+func runTreeCommand(args []string) int {
+	treeFlags := flag.NewFlagSet("tree", flag.ExitOnError)
+	allFlag := treeFlags.Bool("all", false, "Include hidden files and directories")
+	allFlagShort := treeFlags.Bool("a", false, "Include hidden files and directories (shorthand)")
+	rootFlag := treeFlags.String("root", ".", "Root directory for project structure")
+	formatFlag := treeFlags.String("format", "dash", "Output format: dash, ascii, json, yaml, markdown or html")
+	noIgnoreFlag := treeFlags.Bool("no-ignore", false, "Show entries matched by .gitignore and .mkprojignore files")
+	depthFlag := treeFlags.Int("depth", 0, "Descend at most this many levels (default: no limit)")
+	depthFlagShort := treeFlags.Int("L", 0, "Descend at most this many levels (shorthand)")
+	dirsOnlyFlag := treeFlags.Bool("d", false, "List directories only")
+	pruneFlag := treeFlags.Bool("prune", false, "Leave out directories that end up empty")
+	followFlag := treeFlags.Bool("follow-symlinks", false, "List what symlinks point to; links that loop are not followed")
+	sizeFlag := treeFlags.Bool("size", false, "Show file sizes and the total size of each directory")
+	permFlag := treeFlags.Bool("perm", false, "Show permissions")
+	mtimeFlag := treeFlags.Bool("mtime", false, "Show modification times")
+	summaryFlag := treeFlags.Bool("summary", false, "End with an \"N directories, M files\" line")
+	var excludeFlag, includeFlag, patternFlag stringsFlag
+	treeFlags.Var(&excludeFlag, "exclude", "Glob pattern of entries to leave out (repeatable)")
+	treeFlags.Var(&includeFlag, "include", "Glob pattern of entries to show even if hidden, excluded or ignored (repeatable)")
+	treeFlags.Var(&patternFlag, "pattern", "List only files whose name matches this glob; separate alternatives with | (repeatable)")
+	treeFlags.Parse(args)
+
+	format, err := tree.ParseFormat(*formatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	if *summaryFlag && format.MachineReadable() {
+		fmt.Fprintf(os.Stderr, "Error: --summary is not available with --format=%s\n", format)
+		return exitUsage
+	}
+	depth := *depthFlag
+	if *depthFlagShort != 0 {
+		depth = *depthFlagShort
+	}
+	if depth < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid depth %d, expected a positive number of levels\n", depth)
+		return exitUsage
+	}
+	var patterns []string
+	for _, pattern := range patternFlag {
+		patterns = append(patterns, strings.Split(pattern, "|")...)
+	}
+	opts := tree.DisplayOptions{
+		ScanOptions: tree.ScanOptions{
+			ShowHidden:     *allFlag || *allFlagShort,
+			Ignore:         !*noIgnoreFlag,
+			Exclude:        excludeFlag,
+			Include:        includeFlag,
+			Patterns:       patterns,
+			MaxDepth:       depth,
+			DirsOnly:       *dirsOnlyFlag,
+			Prune:          *pruneFlag,
+			FollowSymlinks: *followFlag,
+		},
+		Size:    *sizeFlag,
+		Perm:    *permFlag,
+		ModTime: *mtimeFlag,
+		Summary: *summaryFlag,
+	}
+	if err := tree.Display(os.Stdout, *rootFlag, format, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error displaying directory tree: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jobehi/mkproj/internal/project"
+)
+
+// runUndoCommand handles `mkproj undo` and returns the exit code.
+func runUndoCommand(args []string) int {
+	undoFlags := flag.NewFlagSet("undo", flag.ExitOnError)
+	rootFlag := undoFlags.String("root", ".", "Root directory the structure was created in")
+	dryRunFlag := undoFlags.Bool("dry-run", false, "Print what would be removed without removing anything")
+	undoFlags.Parse(args)
+
+	err := project.Undo(*rootFlag, *dryRunFlag)
+	var undoErr *project.UndoError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, project.ErrNoManifest):
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", *rootFlag, err)
+		return exitInput
+	case errors.As(err, &undoErr):
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitPartial
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return exitError
+}
@@ -5,6 +5,7 @@ go 1.23.2
 require (
 	github.com/gdamore/tcell/v2 v2.7.4
 	github.com/rivo/tview v0.0.0-20240921122403-a64fc48d7654
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,107 @@
+// Package diff compares a structure with a directory that exists on disk.
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// Status is the way an entry differs.
+type Status string
+
+const (
+	// Missing is an entry of the structure that is not in the directory.
+	Missing Status = "missing"
+	// Extra is an entry of the directory that the structure does not have.
+	Extra Status = "extra"
+	// KindMismatch is an entry that is in both, but as a different kind,
+	// such as a directory where the structure has a file.
+	KindMismatch Status = "kind-mismatch"
+)
+
+// Difference is an entry that differs between the structure and the
+// directory. Path is relative to the root, with forward slashes. Want is the
+// kind the structure declares and Got the kind found on disk, "dir", "file",
+// "symlink" or "other"; each is empty when the entry is not on that side.
+// Line is the structure line of the entry, or 0 for extra entries.
+type Difference struct {
+	Status Status `json:"status"`
+	Path   string `json:"path"`
+	Want   string `json:"want,omitempty"`
+	Got    string `json:"got,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// Compare scans rootDir with opts and returns how it differs from the
+// structure nodes, sorted by path. Only the top of a missing or extra
+// directory is reported, not every entry below it, and entries whose kind
+// differs are not looked into. Entries the scan leaves out, such as ignored
+// ones, are never extra, but are still found when the structure declares
+// them.
+func Compare(nodes []*spec.Node, rootDir string, opts tree.ScanOptions) ([]Difference, error) {
+	root, err := tree.Scan(rootDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []Difference
+	compareDir(nodes, root.Children, rootDir, "", &diffs)
+	sort.Slice(diffs, func(i, j int) bool {
+		return pathLess(diffs[i].Path, diffs[j].Path)
+	})
+	return diffs, nil
+}
+
+// compareDir compares the nodes declared in the directory at dir, rel below
+// the root, with the entries scanned in it. Declared entries that were not
+// scanned are looked up on disk.
+func compareDir(nodes []*spec.Node, entries []*tree.Entry, dir, rel string, diffs *[]Difference) {
+	scanned := make(map[string]*tree.Entry, len(entries))
+	for _, entry := range entries {
+		scanned[entry.Name] = entry
+	}
+	declared := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		declared[node.Name] = true
+		path := joinPath(rel, node.Name)
+		want := node.Kind.String()
+		var got string
+		var children []*tree.Entry
+		if entry := scanned[node.Name]; entry != nil {
+			got = spec.ModeKind(entry.Mode)
+			children = entry.Children
+		} else if info, err := os.Lstat(filepath.Join(dir, node.Name)); err == nil {
+			got = spec.ModeKind(info.Mode())
+		}
+		switch {
+		case got == "":
+			*diffs = append(*diffs, Difference{Status: Missing, Path: path, Want: want, Line: node.Line})
+		case got != want:
+			*diffs = append(*diffs, Difference{Status: KindMismatch, Path: path, Want: want, Got: got, Line: node.Line})
+		case node.Kind == spec.Dir:
+			compareDir(node.Children, children, filepath.Join(dir, node.Name), path, diffs)
+		}
+	}
+	for _, entry := range entries {
+		if !declared[entry.Name] {
+			*diffs = append(*diffs, Difference{Status: Extra, Path: joinPath(rel, entry.Name), Got: spec.ModeKind(entry.Mode)})
+		}
+	}
+}
+
+func joinPath(rel, name string) string {
+	if rel == "" {
+		return name
+	}
+	return rel + "/" + name
+}
+
+// pathLess orders slash-separated paths so that a directory comes right
+// before the entries inside it.
+func pathLess(a, b string) bool {
+	return strings.ReplaceAll(a, "/", "\x00") < strings.ReplaceAll(b, "/", "\x00")
+}
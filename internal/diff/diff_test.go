@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/testfs"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// parseStructure parses a dash structure or fails the test.
+func parseStructure(t *testing.T, lines ...string) []*spec.Node {
+	nodes, err := spec.Parse(lines)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	return nodes
+}
+
+// TestCompare tests that missing, extra and mismatched entries are reported
+// once, at the top of the subtree that differs.
+func TestCompare(t *testing.T) {
+	rootDir := testfs.Tree(t,
+		"cmd/app/main.go",
+		"internal/",
+		"README.md/",
+		"build/out/bin",
+		".github/workflows/ci.yml",
+		".env",
+	)
+	if err := os.WriteFile(filepath.Join(rootDir, ".gitignore"), []byte(".env\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	nodes := parseStructure(t,
+		"cmd",
+		"-app",
+		"--main.go",
+		"--flags.go",
+		"internal",
+		"-pkg/",
+		"--util.go",
+		"README.md",
+		".github/",
+		".gitignore",
+		".env",
+	)
+
+	diffs, err := Compare(nodes, rootDir, tree.ScanOptions{ShowHidden: true, Ignore: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Sorted by path, with directories before what they contain
+	expected := []Difference{
+		{Status: Extra, Path: ".github/workflows", Got: "dir"},
+		{Status: KindMismatch, Path: "README.md", Want: "file", Got: "dir", Line: 8},
+		{Status: Extra, Path: "build", Got: "dir"},
+		{Status: Missing, Path: "cmd/app/flags.go", Want: "file", Line: 4},
+		{Status: Missing, Path: "internal/pkg", Want: "dir", Line: 6},
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("Compare() = %+v; want %+v", diffs, expected)
+	}
+	for i := range diffs {
+		if diffs[i] != expected[i] {
+			t.Errorf("Compare()[%d] = %+v; want %+v", i, diffs[i], expected[i])
+		}
+	}
+}
+
+// TestCompare_Equal tests that a directory built from a structure has no
+// differences with it, symlinks included.
+func TestCompare_Equal(t *testing.T) {
+	rootDir := testfs.Tree(t, "src/main.go", "docs/", "v1.2/")
+	lines := []string{"docs", "src", "-main.go", "v1.2/"}
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink("src", filepath.Join(rootDir, "current")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		lines = append(lines, "current -> src")
+	}
+
+	diffs, err := Compare(parseStructure(t, lines...), rootDir, tree.ScanOptions{ShowHidden: true})
+	if err != nil || len(diffs) != 0 {
+		t.Errorf("Compare() = %+v, %v; want no differences", diffs, err)
+	}
+}
+
+// TestWriteText tests the human readable report, with and without colors.
+func TestWriteText(t *testing.T) {
+	diffs := []Difference{
+		{Status: Extra, Path: "build", Got: "dir"},
+		{Status: KindMismatch, Path: "README.md", Want: "file", Got: "dir", Line: 8},
+		{Status: Missing, Path: "cmd/app/flags.go", Want: "file", Line: 4},
+	}
+	tests := []struct {
+		diffs    []Difference
+		color    bool
+		expected string
+	}{
+		{nil, false, "No differences\n"},
+		{diffs, false, "" +
+			"+ extra         build/\n" +
+			"~ kind-mismatch README.md: want file, got dir (line 8)\n" +
+			"- missing       cmd/app/flags.go (line 4)\n" +
+			"3 differences: 1 missing, 1 extra, 1 kind mismatch\n"},
+		{diffs[:1], true, "" +
+			"\033[32m+ extra         build/\033[0m\n" +
+			"1 difference: 0 missing, 1 extra, 0 kind mismatches\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := WriteText(&out, test.diffs, test.color); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if out.String() != test.expected {
+			t.Errorf("WriteText(%v, %v) = %q; want %q", test.diffs, test.color, out.String(), test.expected)
+		}
+	}
+}
+
+// TestWriteJSON tests that the JSON report decodes back, with an empty list
+// rather than null when there is no difference.
+func TestWriteJSON(t *testing.T) {
+	for _, diffs := range [][]Difference{nil, {{Status: Missing, Path: "src", Want: "dir", Line: 1}}} {
+		var out bytes.Buffer
+		if err := WriteJSON(&out, "repo", diffs); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), `"differences": [`) {
+			t.Errorf("WriteJSON(%v) = %s; want a differences list", diffs, out.String())
+		}
+		var report Report
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatalf("WriteJSON(%v) wrote invalid JSON: %v", diffs, err)
+		}
+		if report.Root != "repo" || report.Equal != (len(diffs) == 0) || len(report.Differences) != len(diffs) {
+			t.Errorf("WriteJSON(%v) = %+v", diffs, report)
+		}
+	}
+}
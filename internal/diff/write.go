@@ -0,0 +1,86 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/text"
+)
+
+// ANSI escapes used by WriteText when colors are on.
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// WriteText writes the differences to w, one per line, followed by a count
+// of each status. Missing entries are marked "-", extra ones "+" and kind
+// mismatches "~"; with color, they are red, green and yellow.
+func WriteText(w io.Writer, diffs []Difference, color bool) error {
+	if len(diffs) == 0 {
+		_, err := io.WriteString(w, "No differences\n")
+		return err
+	}
+	var b strings.Builder
+	counts := map[Status]int{}
+	for _, d := range diffs {
+		counts[d.Status]++
+		marker, paint, note := "-", colorRed, ""
+		switch d.Status {
+		case Extra:
+			marker, paint = "+", colorGreen
+		case KindMismatch:
+			marker, paint = "~", colorYellow
+			note = fmt.Sprintf(": want %s, got %s", d.Want, d.Got)
+		}
+		if d.Line > 0 {
+			note += fmt.Sprintf(" (line %d)", d.Line)
+		}
+		line := fmt.Sprintf("%s %-13s %s%s", marker, d.Status, displayPath(d), note)
+		if color {
+			line = paint + line + colorReset
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%s: %d missing, %d extra, %s\n", text.Plural(len(diffs), "difference", "differences"),
+		counts[Missing], counts[Extra], text.Plural(counts[KindMismatch], "kind mismatch", "kind mismatches"))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// displayPath marks directories with a trailing slash, as the structure
+// format does. Kind mismatches are shown as declared.
+func displayPath(d Difference) string {
+	kind := d.Want
+	if kind == "" {
+		kind = d.Got
+	}
+	if kind == "dir" {
+		return d.Path + "/"
+	}
+	return d.Path
+}
+
+// Report is the JSON document written by WriteJSON.
+type Report struct {
+	Root        string       `json:"root"`
+	Equal       bool         `json:"equal"`
+	Differences []Difference `json:"differences"`
+}
+
+// WriteJSON writes the differences between the structure and rootDir to w as
+// an indented Report.
+func WriteJSON(w io.Writer, rootDir string, diffs []Difference) error {
+	report := Report{Root: rootDir, Equal: len(diffs) == 0, Differences: diffs}
+	if report.Differences == nil {
+		report.Differences = []Difference{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
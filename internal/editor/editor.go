@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/jobehi/mkproj/internal/spec"
 	"github.com/rivo/tview"
 )
 
@@ -149,7 +150,7 @@ func (e *Editor) enforceDepth(line string) string {
 	if maxDepth < 0 {
 		maxDepth = 0
 	}
-	dashCount := countLeadingDashes(line)
+	dashCount := spec.CountDepth(line)
 	if dashCount > maxDepth {
 		line = strings.TrimLeft(line, "-")
 		line = strings.Repeat("-", maxDepth) + line
@@ -157,7 +158,9 @@ func (e *Editor) enforceDepth(line string) string {
 	return line
 }
 
-// getMaxAllowedDepth returns the maximum allowed depth.
+// getMaxAllowedDepth returns the maximum allowed depth: one level below the
+// closest directory above, or the same level as the closest file. Names with
+// a dot count as directories when marked with a trailing "/" or ":dir".
 func (e *Editor) getMaxAllowedDepth(currentIndex int) int {
 	if currentIndex == 0 {
 		return 0
@@ -167,12 +170,11 @@ func (e *Editor) getMaxAllowedDepth(currentIndex int) int {
 		if lineContent == "" {
 			continue
 		}
-		depth := countLeadingDashes(lineContent)
-		isFile, _ := isFileLine(lineContent)
-		if !isFile {
-			return depth + 1
+		entry := spec.ParseLine(lineContent)
+		if entry.Kind == spec.Dir {
+			return entry.Depth + 1
 		} else {
-			return depth
+			return entry.Depth
 		}
 	}
 	return 0
@@ -180,8 +182,7 @@ func (e *Editor) getMaxAllowedDepth(currentIndex int) int {
 
 // isLineIncomplete checks if a line is incomplete.
 func (e *Editor) isLineIncomplete(line string) bool {
-	trimmed := strings.TrimLeft(line, "-")
-	return strings.TrimSpace(trimmed) == ""
+	return spec.ParseLine(line).Name == ""
 }
 
 // ValidateStructure checks if the structure is valid.
@@ -193,33 +194,3 @@ func (e *Editor) ValidateStructure() error {
 	}
 	return nil
 }
-
-// countLeadingDashes counts the number of leading dashes.
-func countLeadingDashes(s string) int {
-	count := 0
-	for _, char := range s {
-		if char == '-' {
-			count++
-		} else if char == ' ' || char == '\t' {
-			continue
-		} else {
-			break
-		}
-	}
-	return count
-}
-
-// isFileLine checks if a line represents a file.
-func isFileLine(line string) (bool, string) {
-	name := strings.TrimLeft(line, "-")
-	name = strings.TrimSpace(name)
-	isFile := false
-	if strings.HasSuffix(name, ":file") {
-		isFile = true
-		name = strings.TrimSuffix(name, ":file")
-		name = strings.TrimSpace(name)
-	} else if strings.Contains(name, ".") {
-		isFile = true
-	}
-	return isFile, name
-}
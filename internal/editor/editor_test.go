@@ -4,58 +4,6 @@ import (
 	"testing"
 )
 
-// TestCountLeadingDashes tests the countLeadingDashes function.
-func TestCountLeadingDashes(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int
-	}{
-		{"---file.go", 3},
-		{"- dir", 1},
-		{"--nested", 2},
-		{"no-dashes", 0},
-		{" -mixed", 1},
-		{"", 0},
-		{"\t-tab", 1},
-	}
-
-	for _, test := range tests {
-		result := countLeadingDashes(test.input)
-		if result != test.expected {
-			t.Errorf("countLeadingDashes(%q) = %d; want %d", test.input, result, test.expected)
-		}
-	}
-}
-
-// TestIsFileLine tests the isFileLine function.
-func TestIsFileLine(t *testing.T) {
-	tests := []struct {
-		input        string
-		expectedIs   bool
-		expectedName string
-	}{
-		{"-main.go", true, "main.go"},
-		{"--utils.go", true, "utils.go"},
-		{"-README:file", true, "README"},
-		{"--LICENSE:file", true, "LICENSE"},
-		{"-docs", false, "docs"},
-		{"--src", false, "src"},
-		{"-config", false, "config"},
-		{"-script.sh", true, "script.sh"},
-		{"-noextension:file", true, "noextension"},
-		{"-invalid:fileextra", false, "invalid:fileextra"}, // Edge case
-		{"", false, ""},
-		{"---", false, ""},
-	}
-
-	for _, test := range tests {
-		isFile, name := isFileLine(test.input)
-		if isFile != test.expectedIs || name != test.expectedName {
-			t.Errorf("isFileLine(%q) = (%v, %q); want (%v, %q)", test.input, isFile, name, test.expectedIs, test.expectedName)
-		}
-	}
-}
-
 // TestIsLineIncomplete tests the isLineIncomplete method.
 func TestIsLineIncomplete(t *testing.T) {
 	tests := []struct {
@@ -119,6 +67,27 @@ func TestEnforceDepth(t *testing.T) {
 			line:     "-docs",
 			expected: "-docs",
 		},
+		{
+			name:     "Directory with a dot marked by a trailing slash",
+			lines:    []string{"config.d/", "-app.conf"},
+			currentY: 1,
+			line:     "-app.conf",
+			expected: "-app.conf",
+		},
+		{
+			name:     "Directory with a dot marked by :dir",
+			lines:    []string{"-v1.0:dir", "--spec.yaml"},
+			currentY: 1,
+			line:     "--spec.yaml",
+			expected: "--spec.yaml",
+		},
+		{
+			name:     "Dotted name without marker is a file",
+			lines:    []string{"-v1.0", "--spec.yaml"},
+			currentY: 1,
+			line:     "--spec.yaml",
+			expected: "-spec.yaml",
+		},
 		{
 			name:     "Initial line with no dashes",
 			lines:    []string{""},
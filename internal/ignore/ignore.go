@@ -0,0 +1,250 @@
+// Package ignore reads .gitignore style files and matches paths against
+// them with git's rules:
+//
+//   - blank lines and lines starting with "#" are skipped, and trailing
+//     spaces are dropped unless escaped with a backslash;
+//   - "!" re-includes what an earlier pattern excluded;
+//   - a trailing "/" matches directories only;
+//   - a pattern with a "/" at the start or in the middle is relative to the
+//     directory of the file, any other pattern matches at every level below;
+//   - "*", "?" and "[...]" never match "/", while a leading "**/", a trailing
+//     "/**" and a "/**/" in the middle match across directories.
+//
+// Patterns of deeper files take precedence over those of their parents, and
+// within a file the last matching pattern wins.
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileNames are the ignore files read in every directory, in increasing
+// order of precedence.
+var FileNames = []string{".gitignore", ".mkprojignore"}
+
+// Pattern is a single line of an ignore file.
+type Pattern struct {
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// ParsePattern reads one line of an ignore file. It reports false for blank
+// lines, comments and lines that cannot be a pattern.
+func ParsePattern(line string) (Pattern, bool) {
+	line = trimTrailingSpaces(strings.TrimSuffix(line, "\r"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Pattern{}, false
+	}
+	var p Pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return Pattern{}, false
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	re, err := regexp.Compile(translate(line, anchored))
+	if err != nil {
+		return Pattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// Match reports whether the pattern matches relPath, a slash-separated path
+// relative to the directory of the ignore file.
+func (p Pattern) Match(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return p.re.MatchString(relPath)
+}
+
+// trimTrailingSpaces drops unescaped spaces at the end of line.
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") {
+		trimmed := line[:len(line)-1]
+		if backslashes := len(trimmed) - len(strings.TrimRight(trimmed, "\\")); backslashes%2 == 1 {
+			break
+		}
+		line = trimmed
+	}
+	return line
+}
+
+// translate converts a glob into an anchored regular expression over
+// slash-separated paths.
+func translate(glob string, anchored bool) string {
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); {
+		atSegmentStart := i == 0 || glob[i-1] == '/'
+		switch {
+		case atSegmentStart && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 3
+		case atSegmentStart && glob[i:] == "**":
+			b.WriteString(".*")
+			i += 2
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+			i++
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+			i++
+		case glob[i] == '[':
+			class, n := translateClass(glob[i:])
+			if n == 0 {
+				b.WriteString(`\[`)
+				i++
+				continue
+			}
+			b.WriteString(class)
+			i += n
+		case glob[i] == '\\' && i+1 < len(glob):
+			b.WriteString(regexp.QuoteMeta(glob[i+1 : i+2]))
+			i += 2
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			i++
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// translateClass converts the bracket expression at the start of s and
+// returns it with the number of bytes it used, or 0 when it is not closed.
+func translateClass(s string) (string, int) {
+	var b strings.Builder
+	b.WriteString("[")
+	i := 1
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		b.WriteString("^/")
+		i++
+	}
+	for first := true; i < len(s); first = false {
+		c := s[i]
+		switch {
+		case c == ']' && !first:
+			b.WriteString("]")
+			return b.String(), i + 1
+		case c == '\\' && i+1 < len(s):
+			b.WriteString(regexp.QuoteMeta(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '-':
+			b.WriteByte('-')
+		case strings.IndexByte(`[]^\`, c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+	return "", 0
+}
+
+// ReadFile reads the patterns of an ignore file. A missing file has none.
+func ReadFile(path string) ([]Pattern, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var patterns []Pattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := ParsePattern(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// rule is a pattern together with the directory of the file it came from,
+// relative to the root of the walk.
+type rule struct {
+	base    string
+	pattern Pattern
+}
+
+// Matcher holds the patterns that apply within one directory of a walk. It
+// is never modified once built, so the matchers of sibling directories can
+// share their parent's rules.
+type Matcher struct {
+	rules []rule
+}
+
+// With returns a matcher that adds patterns, read from an ignore file in the
+// directory base, to the rules of m. base is slash-separated and relative to
+// the root of the walk, or "" for the root itself. m may be nil.
+func (m *Matcher) With(base string, patterns []Pattern) *Matcher {
+	if len(patterns) == 0 {
+		return m
+	}
+	var rules []rule
+	if m != nil {
+		rules = make([]rule, len(m.rules), len(m.rules)+len(patterns))
+		copy(rules, m.rules)
+	}
+	for _, p := range patterns {
+		rules = append(rules, rule{base: base, pattern: p})
+	}
+	return &Matcher{rules: rules}
+}
+
+// LoadDir returns a matcher with the rules of the ignore files in dir added
+// to m. base is the path of dir relative to the root of the walk.
+func (m *Matcher) LoadDir(dir, base string) (*Matcher, error) {
+	for _, name := range FileNames {
+		patterns, err := ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return m, err
+		}
+		m = m.With(base, patterns)
+	}
+	return m, nil
+}
+
+// Match reports whether relPath, slash-separated and relative to the root of
+// the walk, is ignored.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, r := range m.rules {
+		path := relPath
+		if r.base != "" {
+			if !strings.HasPrefix(relPath, r.base+"/") {
+				continue
+			}
+			path = relPath[len(r.base)+1:]
+		}
+		if r.pattern.Match(path, isDir) {
+			ignored = !r.pattern.negate
+		}
+	}
+	return ignored
+}
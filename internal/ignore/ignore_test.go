@@ -0,0 +1,171 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParsePattern_Skipped tests the lines that are not patterns.
+func TestParsePattern_Skipped(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "!", "/", "\r"} {
+		if _, ok := ParsePattern(line); ok {
+			t.Errorf("ParsePattern(%q) = ok; want skipped", line)
+		}
+	}
+}
+
+// TestPattern_Match tests single patterns against paths relative to their file.
+func TestPattern_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matched bool
+	}{
+		// Names without a slash match at any level
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"build", "build", true, true},
+		{"build", "src/build", false, true},
+		{"build", "builder", true, false},
+		// A trailing slash matches directories only
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		// A leading or middle slash anchors to the file's directory
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"doc/frotz", "doc/frotz", true, true},
+		{"doc/frotz", "a/doc/frotz", true, false},
+		{"doc/frotz/", "doc/frotz", true, true},
+		// Single wildcards never cross directories
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/sub/notes.txt", false, false},
+		{"a?c", "abc", false, true},
+		{"a?c", "a/c", false, false},
+		{"a?c", "ac", false, false},
+		// Double asterisks
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"**/foo/bar", "x/foo/bar", false, true},
+		{"**/foo/bar", "foo/bar", false, true},
+		{"abc/**", "abc/x", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/xb", false, false},
+		{"a**b", "axxb", false, true},
+		{"a**b", "ax/xb", false, false},
+		// Bracket expressions
+		{"file[0-9].txt", "file1.txt", false, true},
+		{"file[0-9].txt", "filea.txt", false, false},
+		{"file[!0-9].txt", "filea.txt", false, true},
+		{"file[^0-9].txt", "file1.txt", false, false},
+		{"x[!a]y", "x/y", false, false},
+		{"[]]", "]", false, true},
+		{"a[", "a[", false, true},
+		// Escapes and trailing spaces
+		{`\!important`, "!important", false, true},
+		{`\#hash`, "#hash", false, true},
+		{"trailing   ", "trailing", false, true},
+		{`space\ `, "space ", false, true},
+		{`a\*b`, "a*b", false, true},
+		{`a\*b`, "axb", false, false},
+		{"a.b", "axb", false, false},
+		{"a+(b)", "a+(b)", false, true},
+	}
+
+	for _, test := range tests {
+		pattern, ok := ParsePattern(test.pattern)
+		if !ok {
+			t.Errorf("ParsePattern(%q) was skipped", test.pattern)
+			continue
+		}
+		if matched := pattern.Match(test.path, test.isDir); matched != test.matched {
+			t.Errorf("ParsePattern(%q).Match(%q, %t) = %t; want %t", test.pattern, test.path, test.isDir, matched, test.matched)
+		}
+	}
+}
+
+// TestMatcher_Match tests precedence between patterns and between files.
+func TestMatcher_Match(t *testing.T) {
+	parse := func(lines ...string) []Pattern {
+		var patterns []Pattern
+		for _, line := range lines {
+			if p, ok := ParsePattern(line); ok {
+				patterns = append(patterns, p)
+			}
+		}
+		return patterns
+	}
+	root := (*Matcher)(nil).With("", parse("*.log", "!keep.log", "/out", "tmp/"))
+	nested := root.With("src", parse("!debug.log", "gen", "/local"))
+
+	tests := []struct {
+		matcher *Matcher
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{root, "debug.log", false, true},
+		{root, "keep.log", false, false},
+		{root, "src/keep.log", false, false},
+		{root, "out", true, true},
+		{root, "src/out", true, false},
+		{root, "a/tmp", true, true},
+		{root, "a/tmp", false, false},
+		{root, "main.go", false, false},
+		{nested, "src/debug.log", false, false},
+		{nested, "debug.log", false, true},
+		{nested, "src/other.log", false, true},
+		{nested, "src/gen", true, true},
+		{nested, "src/a/gen", false, true},
+		{nested, "gen", true, false},
+		{nested, "src/local", true, true},
+		{nested, "src/a/local", true, false},
+		{nested, "srcx/gen", true, false},
+		{nil, "anything", false, false},
+	}
+
+	for _, test := range tests {
+		if ignored := test.matcher.Match(test.path, test.isDir); ignored != test.ignored {
+			t.Errorf("Match(%q, %t) = %t; want %t", test.path, test.isDir, ignored, test.ignored)
+		}
+	}
+	if len(root.rules) != 4 {
+		t.Errorf("With changed the parent matcher: %d rules; want 4", len(root.rules))
+	}
+}
+
+// TestLoadDir tests that .mkprojignore takes precedence over .gitignore.
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":    "# build output\nbin/\n*.tmp\n",
+		".mkprojignore": "!keep.tmp\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	matcher, err := (*Matcher)(nil).LoadDir(dir, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tests := map[string]bool{"bin": true, "a.tmp": true, "keep.tmp": false, "main.go": false}
+	for path, expected := range tests {
+		if ignored := matcher.Match(path, path == "bin"); ignored != expected {
+			t.Errorf("Match(%q) = %t; want %t", path, ignored, expected)
+		}
+	}
+
+	matcher, err = (*Matcher)(nil).LoadDir(t.TempDir(), "")
+	if err != nil || matcher != nil {
+		t.Errorf("LoadDir(empty dir) = %v, %v; want no rules", matcher, err)
+	}
+}
@@ -0,0 +1,358 @@
+package project
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jobehi/mkproj/internal/spec"
+)
+
+// ActionKind is what applying a structure does to an entry.
+type ActionKind int
+
+const (
+	// ActionCreate creates a missing entry.
+	ActionCreate ActionKind = iota
+	// ActionUpdate rewrites the content of a file, retargets a symlink or
+	// changes permission bits, in place.
+	ActionUpdate
+	// ActionReplace removes an entry of the wrong kind, with everything in
+	// it, and creates the declared one.
+	ActionReplace
+	// ActionDelete removes an entry the structure does not declare, with
+	// everything in it.
+	ActionDelete
+)
+
+// String returns the verb used when printing a plan.
+func (k ActionKind) String() string {
+	switch k {
+	case ActionCreate:
+		return "create"
+	case ActionUpdate:
+		return "update"
+	case ActionReplace:
+		return "replace"
+	}
+	return "delete"
+}
+
+// symbol marks the kind of action in a printed plan.
+func (k ActionKind) symbol() string {
+	switch k {
+	case ActionCreate:
+		return "+"
+	case ActionUpdate:
+		return "~"
+	case ActionReplace:
+		return "-/+"
+	}
+	return "-"
+}
+
+// Action is a change that brings one entry in line with the structure.
+// Reason says why it is needed. Op is the operation that creates or updates
+// the entry, unset for deletions.
+type Action struct {
+	Kind   ActionKind
+	Path   string
+	Line   int
+	Reason string
+	Op     Operation
+
+	rewrite bool // an update that rewrites content or a link, not just the mode
+}
+
+// ApplyPlan is the list of actions that make a directory match a structure.
+// Blocked lists the entries of the wrong kind that are left alone because
+// the plan does not prune.
+type ApplyPlan struct {
+	Root       string
+	RootExists bool
+	Actions    []Action
+	Blocked    []Action
+
+	manifest bool // record the changes in the manifest, from Options.Manifest
+}
+
+// PlanApply compares the structure in lines with rootDir and works out what
+// to create, update and, with prune, replace. Files are only updated when
+// the structure gives their content, and permission bits when it gives a
+// mode. Entries the structure does not declare are not looked for; Delete
+// adds them to the plan. With opts.Manifest, Apply records its changes in
+// the manifest of the root.
+func PlanApply(lines []string, rootDir string, opts Options, prune bool) (*ApplyPlan, error) {
+	plan, err := PlanProjectStructure(lines, rootDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	p := &ApplyPlan{Root: rootDir, RootExists: plan.RootExists, manifest: opts.Manifest}
+	var blocked, replaced []string // directories left alone, and directories recreated
+	for _, op := range plan.Operations {
+		if insideAny(op.Path, blocked) {
+			continue
+		}
+		action := Action{Kind: ActionCreate, Path: op.Path, Line: op.Line, Op: op}
+		info, err := os.Lstat(op.Path)
+		if err != nil || insideAny(op.Path, replaced) {
+			// Below a replaced directory, what exists now will be gone
+			action.Op.Exists, action.Op.Conflict = false, ""
+			if len(op.Content) > 0 {
+				action.Reason = fmt.Sprintf("%d bytes", len(op.Content))
+			}
+			p.Actions = append(p.Actions, action)
+			continue
+		}
+		want, got := op.Kind.entryKind(), spec.ModeKind(info.Mode())
+		if got != want {
+			action.Kind = ActionReplace
+			action.Reason = fmt.Sprintf("%s in the way of a %s", got, want)
+			if !prune {
+				p.Blocked = append(p.Blocked, action)
+				if op.Kind == OpCreateDir {
+					blocked = append(blocked, op.Path)
+				}
+				continue
+			}
+			if op.Kind == OpCreateDir {
+				replaced = append(replaced, op.Path)
+			}
+			p.Actions = append(p.Actions, action)
+			continue
+		}
+		action.Kind = ActionUpdate
+		switch op.Kind {
+		case OpCreateFile:
+			if len(op.Content) > 0 {
+				if existing, err := os.ReadFile(op.Path); err != nil || !bytes.Equal(existing, op.Content) {
+					action.Reason = "content differs"
+					action.rewrite = true
+				}
+			}
+		case OpCreateSymlink:
+			if target, _ := os.Readlink(op.Path); target != op.Target {
+				action.Reason = fmt.Sprintf("link to %s, not %s", target, op.Target)
+				action.rewrite = true
+			}
+		}
+		if op.Mode != 0 && runtime.GOOS != "windows" && info.Mode().Perm() != op.Mode.Perm() {
+			if action.Reason != "" {
+				action.Reason += ", "
+			}
+			action.Reason += fmt.Sprintf("mode %04o -> %04o", uint32(info.Mode().Perm()), uint32(op.Mode.Perm()))
+		}
+		if action.Reason != "" {
+			p.Actions = append(p.Actions, action)
+		}
+	}
+
+	return p, nil
+}
+
+// Delete adds the deletion of each of paths to the plan. Paths are relative
+// to the root with forward slashes, like the extra entries diff.Compare
+// reports.
+func (p *ApplyPlan) Delete(paths []string) {
+	for _, path := range paths {
+		fullPath := filepath.Join(p.Root, filepath.FromSlash(path))
+		reason := "not in the structure"
+		if info, err := os.Lstat(fullPath); err == nil {
+			reason = spec.ModeKind(info.Mode()) + " " + reason
+		}
+		p.Actions = append(p.Actions, Action{Kind: ActionDelete, Path: fullPath, Reason: reason})
+	}
+}
+
+// entryKind names the kind of entry the operation creates, as
+// spec.ModeKind does.
+func (k OpKind) entryKind() string {
+	switch k {
+	case OpCreateFile:
+		return spec.File.String()
+	case OpCreateSymlink:
+		return spec.Symlink.String()
+	}
+	return spec.Dir.String()
+}
+
+// Empty reports whether the directory already matches the structure, as far
+// as the plan can fix it.
+func (p *ApplyPlan) Empty() bool {
+	return p.RootExists && len(p.Actions) == 0
+}
+
+// Print writes a human readable version of the plan to w.
+func (p *ApplyPlan) Print(w io.Writer) {
+	if p.Empty() && len(p.Blocked) == 0 {
+		fmt.Fprintf(w, "No changes: %s matches the structure.\n", p.Root)
+		return
+	}
+	fmt.Fprintf(w, "Planned changes for %s:\n", p.Root)
+	if !p.RootExists {
+		fmt.Fprintf(w, "%3s %-7s %s\n", ActionCreate.symbol(), ActionCreate, p.Root)
+	}
+	counts := map[ActionKind]int{}
+	for _, action := range p.Actions {
+		counts[action.Kind]++
+		note := ""
+		if action.Reason != "" {
+			note = " (" + action.Reason + ")"
+		}
+		fmt.Fprintf(w, "%3s %-7s %s%s\n", action.Kind.symbol(), action.Kind, action.Path, note)
+	}
+	for _, action := range p.Blocked {
+		fmt.Fprintf(w, "%3s %-7s %s (%s, use --prune to replace it)\n", "!", "keep", action.Path, action.Reason)
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to replace, %d to delete.\n",
+		counts[ActionCreate], counts[ActionUpdate], counts[ActionReplace], counts[ActionDelete])
+}
+
+// Apply carries out the plan. Deletions and the removal of entries to
+// replace come first, then everything is created or updated in structure
+// order. It keeps going past failures and reports them in a *BuildError.
+// When the plan records a manifest, the entries apply created are added to
+// it, so that Undo can remove them, and the entries it deleted or rewrote
+// are updated.
+func Apply(p *ApplyPlan) error {
+	fmt.Println("Applying changes... Hold on tight! 🛠️")
+	if err := os.MkdirAll(p.Root, 0755); err != nil {
+		return &RootError{Path: p.Root, Err: err}
+	}
+	confine, err := newConfiner(p.Root)
+	if err != nil {
+		return &RootError{Path: p.Root, Err: err}
+	}
+	b := &builder{policy: ConflictOverwrite, confine: confine, manifest: p.manifest}
+
+	var ops, rewritten []Operation
+	var modes []Action
+	var removed []string // deleted and replaced entries
+	for _, action := range p.Actions {
+		switch action.Kind {
+		case ActionDelete, ActionReplace:
+			if err := confine.check(action.Path); err != nil {
+				b.failures = append(b.failures, newFailure(action.Path, action.Line, err))
+				continue
+			}
+			if err := os.RemoveAll(action.Path); err != nil {
+				b.failures = append(b.failures, newFailure(action.Path, action.Line, err))
+				continue
+			}
+			fmt.Printf("Deleted: %s\n", action.Path)
+			removed = append(removed, action.Path)
+			if action.Kind == ActionReplace {
+				op := action.Op
+				op.Exists, op.Conflict = false, ""
+				ops = append(ops, op)
+			}
+		case ActionCreate:
+			ops = append(ops, action.Op)
+		case ActionUpdate:
+			if action.rewrite {
+				// The overwrite policy rewrites files in place and replaces links
+				op := action.Op
+				op.Conflict = action.Reason
+				ops = append(ops, op)
+				rewritten = append(rewritten, op)
+			} else {
+				modes = append(modes, action)
+			}
+		}
+	}
+	b.apply(ops)
+	for _, action := range modes {
+		err := confine.check(action.Path)
+		if err == nil {
+			err = chmod(action.Path, action.Op.Mode)
+		}
+		if err != nil {
+			b.fail(action.Op, err)
+			continue
+		}
+		fmt.Printf("Changed mode: %s %04o\n", action.Path, uint32(action.Op.Mode.Perm()))
+	}
+	if b.manifest {
+		b.recordApply(p, removed, rewritten)
+	}
+	if len(b.failures) > 0 {
+		return &BuildError{Failures: b.failures}
+	}
+	return nil
+}
+
+// recordApply brings the manifest of the root up to date once p is applied.
+// Entries at or below a removed path leave it, and files and links that
+// were rewritten get their new content hash or target. What apply created is
+// added, except the entries that replaced others, whose paths were taken
+// before. Without a manifest, one is started if apply created something.
+func (b *builder) recordApply(p *ApplyPlan, removed []string, rewritten []Operation) {
+	manifest, err := ReadManifest(p.Root)
+	if errors.Is(err, ErrNoManifest) {
+		if len(b.created) == 0 {
+			return
+		}
+		manifest, err = &Manifest{Version: manifestVersion, RootCreated: !p.RootExists}, nil
+	}
+	if err != nil {
+		b.failures = append(b.failures, newFailure(ManifestPath(p.Root), 0, err))
+		return
+	}
+	failed := map[string]bool{}
+	for _, failure := range b.failures {
+		failed[failure.Path] = true
+	}
+	gone := map[string]bool{}
+	for _, path := range removed {
+		rel, _ := filepath.Rel(p.Root, path)
+		gone[filepath.ToSlash(rel)] = true
+	}
+	updated := map[string]ManifestEntry{}
+	for _, op := range rewritten {
+		if !failed[op.Path] {
+			entry := manifestEntry(p.Root, op)
+			updated[entry.Path] = entry
+		}
+	}
+
+	var entries []ManifestEntry
+	for _, entry := range manifest.Entries {
+		if removedAt(entry.Path, gone) {
+			continue
+		}
+		if update, ok := updated[entry.Path]; ok {
+			entry = update
+		}
+		entries = append(entries, entry)
+	}
+	for _, entry := range b.created {
+		if !gone[entry.Path] {
+			entries = append(entries, entry)
+		}
+	}
+	manifest.Created = time.Now().UTC()
+	manifest.Entries = entries
+	if _, err := writeManifest(p.Root, manifest); err != nil {
+		b.failures = append(b.failures, newFailure(ManifestPath(p.Root), 0, err))
+	}
+}
+
+// removedAt reports whether the manifest path is one of gone, or below one.
+func removedAt(path string, gone map[string]bool) bool {
+	for {
+		if gone[path] {
+			return true
+		}
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			return false
+		}
+		path = path[:i]
+	}
+}
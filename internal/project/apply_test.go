@@ -0,0 +1,247 @@
+package project
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// setupApplyRoot creates a root that differs from applyLines in every way
+// PlanApply looks at.
+func setupApplyRoot(t *testing.T) string {
+	rootDir := t.TempDir()
+	for _, dir := range []string{"build", "docs", "src"} {
+		if err := os.Mkdir(filepath.Join(rootDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	files := map[string]string{
+		"README.md":   "old\n",
+		"notes.txt":   "kept\n",
+		"run.sh":      "",
+		"docs/x.md":   "",
+		"src/main.go": "package main\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(rootDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	return rootDir
+}
+
+// applyLines is the structure applied to setupApplyRoot.
+var applyLines = []string{
+	"README.md <<EOF",
+	"new",
+	"EOF",
+	"notes.txt",
+	"run.sh [mode=0755]",
+	"docs:file",
+	"src",
+	"-main.go",
+	"-util.go",
+}
+
+// TestPlanApply tests the actions planned with and without prune.
+func TestPlanApply(t *testing.T) {
+	rootDir := setupApplyRoot(t)
+	tests := []struct {
+		prune    bool
+		expected string
+	}{
+		{false, "" +
+			"  ~ update  README.md (content differs)\n" +
+			"  ~ update  run.sh (mode 0644 -> 0755)\n" +
+			"  + create  src/util.go\n" +
+			"  ! keep    docs (dir in the way of a file, use --prune to replace it)\n" +
+			"Plan: 1 to create, 2 to update, 0 to replace, 0 to delete.\n"},
+		{true, "" +
+			"  ~ update  README.md (content differs)\n" +
+			"  ~ update  run.sh (mode 0644 -> 0755)\n" +
+			"-/+ replace docs (dir in the way of a file)\n" +
+			"  + create  src/util.go\n" +
+			"  - delete  build (dir not in the structure)\n" +
+			"Plan: 1 to create, 2 to update, 1 to replace, 1 to delete.\n"},
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not planned on Windows")
+	}
+
+	for _, test := range tests {
+		plan, err := PlanApply(applyLines, rootDir, Options{}, test.prune)
+		if err != nil {
+			t.Fatalf("PlanApply(prune %v) unexpected error: %v", test.prune, err)
+		}
+		if test.prune {
+			plan.Delete([]string{"build"})
+		}
+		var out bytes.Buffer
+		plan.Print(&out)
+		got := strings.ReplaceAll(out.String(), rootDir+string(filepath.Separator), "")
+		got = strings.TrimPrefix(got, "Planned changes for "+rootDir+":\n")
+		if got != test.expected {
+			t.Errorf("PlanApply(prune %v) printed:\n%s\nwant:\n%s", test.prune, got, test.expected)
+		}
+	}
+}
+
+// TestApply tests that applying a plan brings the root in line with the
+// structure, after which there is nothing left to do.
+func TestApply(t *testing.T) {
+	rootDir := setupApplyRoot(t)
+	plan, err := PlanApply(applyLines, rootDir, Options{}, true)
+	if err != nil {
+		t.Fatalf("PlanApply() unexpected error: %v", err)
+	}
+	plan.Delete([]string{"build"})
+	if err := Apply(plan); err != nil {
+		t.Fatalf("Apply() unexpected error: %v", err)
+	}
+
+	validateStructure(t, []string{filepath.Join(rootDir, "src")}, []string{
+		filepath.Join(rootDir, "docs"),
+		filepath.Join(rootDir, "src", "util.go"),
+	})
+	if _, err := os.Stat(filepath.Join(rootDir, "build")); !os.IsNotExist(err) {
+		t.Errorf("Expected build to be deleted")
+	}
+	contents := map[string]string{"README.md": "new\n", "notes.txt": "kept\n", "src/main.go": "package main\n"}
+	for name, want := range contents {
+		if content, _ := os.ReadFile(filepath.Join(rootDir, name)); string(content) != want {
+			t.Errorf("Content of %s = %q; want %q", name, content, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(rootDir, "run.sh")); runtime.GOOS != "windows" && (err != nil || info.Mode().Perm() != 0755) {
+		t.Errorf("Expected run.sh to have mode 0755, got %v", info.Mode())
+	}
+
+	again, err := PlanApply(applyLines, rootDir, Options{}, true)
+	if err != nil {
+		t.Fatalf("PlanApply() unexpected error: %v", err)
+	}
+	if !again.Empty() || len(again.Blocked) != 0 {
+		t.Errorf("Expected nothing left to apply, got %+v", again.Actions)
+	}
+}
+
+// TestApply_NewRoot tests applying a structure to a root that does not
+// exist yet.
+func TestApply_NewRoot(t *testing.T) {
+	rootDir := filepath.Join(t.TempDir(), "project")
+	plan, err := PlanApply([]string{"src", "-main.go"}, rootDir, Options{}, false)
+	if err != nil {
+		t.Fatalf("PlanApply() unexpected error: %v", err)
+	}
+	if plan.Empty() || len(plan.Actions) != 2 {
+		t.Fatalf("Expected 2 actions, got %+v", plan.Actions)
+	}
+	if err := Apply(plan); err != nil {
+		t.Fatalf("Apply() unexpected error: %v", err)
+	}
+	validateStructure(t, []string{filepath.Join(rootDir, "src")}, []string{filepath.Join(rootDir, "src", "main.go")})
+}
+
+// TestApply_Manifest tests that apply keeps the manifest of the root up to
+// date, so that Undo removes what create and apply made together.
+func TestApply_Manifest(t *testing.T) {
+	rootDir := t.TempDir()
+	created := []string{
+		"src",
+		"-main.go <<EOF",
+		"package main",
+		"EOF",
+		"docs",
+		"-x.md",
+	}
+	if err := BuildProjectStructure(created, rootDir, Options{Manifest: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(rootDir, "LICENSE"), []byte("mine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	applied := []string{
+		"src",
+		"-main.go <<EOF",
+		"package app",
+		"EOF",
+		"-util.go",
+		"docs:file",
+		"LICENSE <<EOF",
+		"MIT",
+		"EOF",
+	}
+	plan, err := PlanApply(applied, rootDir, Options{Manifest: true}, true)
+	if err != nil {
+		t.Fatalf("PlanApply() unexpected error: %v", err)
+	}
+	if err := Apply(plan); err != nil {
+		t.Fatalf("Apply() unexpected error: %v", err)
+	}
+
+	manifest, err := ReadManifest(rootDir)
+	if err != nil {
+		t.Fatalf("ReadManifest(%q) unexpected error: %v", rootDir, err)
+	}
+	want := []ManifestEntry{
+		{Path: "src", Kind: "dir"},
+		{Path: "src/main.go", Kind: "file", SHA256: "75d99e22087438b67ab1768073505b6ad05fa235b57f02efe129400534b6053c"},
+		{Path: "src/util.go", Kind: "file", SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+	if len(manifest.Entries) != len(want) {
+		t.Fatalf("Manifest entries = %+v; want %+v", manifest.Entries, want)
+	}
+	for i, entry := range manifest.Entries {
+		if entry != want[i] {
+			t.Errorf("Manifest entry %d = %+v; want %+v", i, entry, want[i])
+		}
+	}
+
+	// The replaced and updated entries existed before apply, and stay
+	if err := Undo(rootDir, false); err != nil {
+		t.Fatalf("Undo(%q, false) unexpected error: %v", rootDir, err)
+	}
+	validateStructure(t, nil, []string{filepath.Join(rootDir, "docs"), filepath.Join(rootDir, "LICENSE")})
+	if _, err := os.Lstat(filepath.Join(rootDir, "src")); !os.IsNotExist(err) {
+		t.Errorf("Expected src to be removed")
+	}
+}
+
+// TestApply_ModeThroughSymlink tests that a mode update does not follow a
+// symlink that took the place of the file after planning.
+func TestApply_ModeThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	outside := filepath.Join(t.TempDir(), "target")
+	rootDir := t.TempDir()
+	for _, path := range []string{outside, filepath.Join(rootDir, "run.sh")} {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	plan, err := PlanApply([]string{"run.sh [mode=0777]"}, rootDir, Options{}, false)
+	if err != nil {
+		t.Fatalf("PlanApply() unexpected error: %v", err)
+	}
+	if err := os.Remove(filepath.Join(rootDir, "run.sh")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(rootDir, "run.sh")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	err = Apply(plan)
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) || len(buildErr.Failures) != 1 || !errors.Is(buildErr.Failures[0], ErrSymlink) {
+		t.Fatalf("Expected a symlink failure, got %v", err)
+	}
+	if info, err := os.Stat(outside); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected the mode outside the root to stay 0644, got %v", info.Mode())
+	}
+}
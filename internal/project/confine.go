@@ -0,0 +1,116 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot is the cause of failures for entries whose path would lead
+// outside the root directory, directly or through a symlink.
+var ErrOutsideRoot = errors.New("path leads outside the root directory")
+
+// ErrSymlink is the cause of failures for files and modes that would be
+// written through a symlink found in place of the entry.
+var ErrSymlink = errors.New("refusing to write through a symlink")
+
+// ErrOutsideBase is the cause of source errors for content sources that are
+// absolute or lead outside the base directory, directly or through a symlink.
+var ErrOutsideBase = errors.New("path leads outside the base directory")
+
+// confiner keeps the operations of a build inside its root. Structure names
+// are validated when parsed, so paths cannot escape on their own; what is
+// left are symlinks, already there or created by the build, that would carry
+// a later entry elsewhere.
+type confiner struct {
+	root     string          // the root as given, cleaned
+	realRoot string          // the root with every symlink resolved
+	verified map[string]bool // directories known to resolve inside realRoot
+}
+
+// newConfiner resolves root, which must exist.
+func newConfiner(root string) (*confiner, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return nil, err
+	}
+	return &confiner{root: filepath.Clean(root), realRoot: realRoot, verified: map[string]bool{}}, nil
+}
+
+// check returns an error wrapping ErrOutsideRoot unless path lies below the
+// root and its parent directory, once symlinks are resolved, is the root or
+// inside it. The entry at path itself is not resolved: it is the one being
+// created or replaced.
+func (c *confiner) check(path string) error {
+	if !within(c.root, filepath.Clean(path)) || filepath.Clean(path) == c.root {
+		return ErrOutsideRoot
+	}
+	parent := filepath.Dir(filepath.Clean(path))
+	if c.verified[parent] {
+		return nil
+	}
+	realParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return err
+	}
+	if realParent, err = filepath.Abs(realParent); err != nil {
+		return err
+	}
+	if !within(c.realRoot, realParent) {
+		return fmt.Errorf("%w: %s resolves to %s", ErrOutsideRoot, parent, realParent)
+	}
+	c.verified[parent] = true
+	return nil
+}
+
+// resolveSource returns the path of the content source below baseDir, the
+// working directory when empty. Sources must be relative and stay inside
+// baseDir once symlinks are resolved, so that a shared structure cannot copy
+// other local files, such as keys, into the project. Sources that do not
+// exist are returned as they are, for reading them to fail.
+func resolveSource(baseDir, source string) (string, error) {
+	if filepath.IsAbs(source) || filepath.VolumeName(source) != "" || strings.HasPrefix(source, "/") || strings.HasPrefix(source, `\`) {
+		return "", fmt.Errorf("%w: %s is an absolute path", ErrOutsideBase, source)
+	}
+	if baseDir == "" {
+		baseDir = "."
+	}
+	baseDir = filepath.Clean(baseDir)
+	path := filepath.Join(baseDir, source)
+	if !within(baseDir, path) || path == baseDir {
+		return "", fmt.Errorf("%w: %s", ErrOutsideBase, source)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path, nil
+	}
+	realBase, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return "", err
+	}
+	if realBase, err = filepath.Abs(realBase); err != nil {
+		return "", err
+	}
+	if realPath, err = filepath.Abs(realPath); err != nil {
+		return "", err
+	}
+	if !within(realBase, realPath) {
+		return "", fmt.Errorf("%w: %s resolves to %s", ErrOutsideBase, source, realPath)
+	}
+	return path, nil
+}
+
+// within reports whether path is dir or below it. Both must be clean and
+// either both absolute or both relative.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
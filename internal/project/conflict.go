@@ -0,0 +1,115 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConflictPolicy decides what happens to an existing entry that is in the
+// way of a planned operation.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves the existing entry untouched, along with whatever
+	// the structure puts inside it. It is the default.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing entry. Directories are only
+	// removed when they are empty.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictFail stops before anything is created when there is any
+	// conflict.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictBackup renames the existing entry with a ".bak" suffix, then
+	// creates the new one.
+	ConflictBackup ConflictPolicy = "backup"
+	// ConflictPrompt asks what to do about each conflict through
+	// Options.Prompt.
+	ConflictPrompt ConflictPolicy = "prompt"
+)
+
+// ConflictPolicies lists the policies accepted by ParseConflictPolicy.
+var ConflictPolicies = []ConflictPolicy{ConflictSkip, ConflictOverwrite, ConflictFail, ConflictBackup, ConflictPrompt}
+
+// ParseConflictPolicy validates a policy name given on the command line.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	names := make([]string, len(ConflictPolicies))
+	for i, policy := range ConflictPolicies {
+		if string(policy) == name {
+			return policy, nil
+		}
+		names[i] = string(policy)
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Conflict is an existing entry that an operation would change. Resolution
+// is the policy that was applied to it, and Backup the path it was moved to
+// by ConflictBackup.
+type Conflict struct {
+	Path       string
+	Line       int
+	Reason     string
+	Resolution ConflictPolicy
+	Backup     string
+}
+
+// String formats the conflict as "line N: path: reason (outcome)".
+func (c Conflict) String() string {
+	outcome := ""
+	switch c.Resolution {
+	case ConflictSkip:
+		outcome = " (skipped)"
+	case ConflictOverwrite:
+		outcome = " (overwritten)"
+	case ConflictBackup:
+		outcome = fmt.Sprintf(" (backed up to %s)", c.Backup)
+	}
+	return fmt.Sprintf("line %d: %s: %s%s", c.Line, c.Path, c.Reason, outcome)
+}
+
+// conflictReason explains why op cannot be carried out without changing what
+// already exists at its path, or returns "" when it can: the path is free, a
+// wanted directory or link is already there, or a wanted file is empty or
+// already has the right content.
+func conflictReason(op Operation) string {
+	info, err := os.Lstat(op.Path)
+	if err != nil {
+		return ""
+	}
+	switch op.Kind {
+	case OpCreateDir:
+		if !info.IsDir() {
+			return "exists and is not a directory"
+		}
+	case OpCreateSymlink:
+		if target, err := os.Readlink(op.Path); err != nil || target != op.Target {
+			return "exists and is not a link to " + op.Target
+		}
+	default:
+		if !info.Mode().IsRegular() {
+			return "exists and is not a regular file"
+		}
+		if info.Size() == 0 {
+			return ""
+		}
+		if info.Size() == int64(len(op.Content)) {
+			if existing, err := os.ReadFile(op.Path); err == nil && bytes.Equal(existing, op.Content) {
+				return ""
+			}
+		}
+		return "file has other content"
+	}
+	return ""
+}
+
+// backupPath returns the first of path.bak, path.bak.1, path.bak.2... that
+// does not exist.
+func backupPath(path string) string {
+	backup := path + ".bak"
+	for i := 1; pathExists(backup); i++ {
+		backup = fmt.Sprintf("%s.bak.%d", path, i)
+	}
+	return backup
+}
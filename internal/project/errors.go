@@ -0,0 +1,124 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/text"
+)
+
+// Failure records a single structure entry that could not be created.
+type Failure struct {
+	Path string
+	Line int
+	Err  error
+}
+
+// Error formats the failure as "line N: path: cause".
+func (f Failure) Error() string {
+	return fmt.Sprintf("line %d: %s: %v", f.Line, f.Path, f.Err)
+}
+
+// Unwrap returns the cause of the failure.
+func (f Failure) Unwrap() error {
+	return f.Err
+}
+
+// newFailure builds a Failure, stripping the path from fs errors so it is not repeated.
+func newFailure(path string, line int, err error) Failure {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return Failure{Path: path, Line: line, Err: err}
+}
+
+// BuildError is returned when one or more entries of a structure failed.
+// RolledBack is set when the entries that were created have been removed
+// again, by an atomic build.
+type BuildError struct {
+	Failures   []Failure
+	RolledBack bool
+}
+
+// Error lists every failed entry on its own line.
+func (e *BuildError) Error() string {
+	var b strings.Builder
+	b.WriteString("failed to create " + text.Plural(len(e.Failures), "entry", "entries"))
+	if e.RolledBack {
+		b.WriteString(", all changes were undone")
+	}
+	b.WriteString(":")
+	for _, failure := range e.Failures {
+		b.WriteString("\n  ")
+		b.WriteString(failure.Error())
+	}
+	return b.String()
+}
+
+// Unwrap exposes the individual failures to errors.Is and errors.As.
+func (e *BuildError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, failure := range e.Failures {
+		errs[i] = failure
+	}
+	return errs
+}
+
+// RootError is returned when the root directory itself cannot be created.
+type RootError struct {
+	Path string
+	Err  error
+}
+
+// Error formats the root directory failure.
+func (e *RootError) Error() string {
+	return fmt.Sprintf("cannot create root directory %s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the cause of the root directory failure.
+func (e *RootError) Unwrap() error {
+	return e.Err
+}
+
+// SourceError is returned when the content source of a file cannot be read
+// or rendered.
+type SourceError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+// Error formats the source failure with the line that referenced it.
+func (e *SourceError) Error() string {
+	var renderErr *render.Error
+	if errors.As(e.Err, &renderErr) {
+		return fmt.Sprintf("line %d: cannot render content source %s: %v", e.Line, e.Path, e.Err)
+	}
+	return fmt.Sprintf("line %d: cannot read content source: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the cause of the source failure.
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// ConflictError is returned by ConflictFail when existing entries are in the
+// way. Nothing has been created.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+// Error lists every conflict on its own line.
+func (e *ConflictError) Error() string {
+	var b strings.Builder
+	b.WriteString(text.Plural(len(e.Conflicts), "existing entry conflicts", "existing entries conflict") + " with the structure:")
+	for _, conflict := range e.Conflicts {
+		b.WriteString("\n  ")
+		b.WriteString(conflict.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,276 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jobehi/mkproj/internal/text"
+)
+
+// ManifestDir is the directory, inside the root, that holds the manifest.
+const ManifestDir = ".mkproj"
+
+// manifestVersion is the version of the manifest format written by this
+// package; Undo refuses newer ones.
+const manifestVersion = 1
+
+// ErrNoManifest is returned by Undo when the root has no manifest.
+var ErrNoManifest = errors.New("no manifest, nothing to undo")
+
+// ManifestPath returns the path of the manifest of rootDir.
+func ManifestPath(rootDir string) string {
+	return filepath.Join(rootDir, ManifestDir, "manifest.json")
+}
+
+// Manifest lists the entries a build created, in the order it created them,
+// so that they can be removed again. RootCreated is set when the build
+// created the root directory as well.
+type Manifest struct {
+	Version     int             `json:"version"`
+	Created     time.Time       `json:"created"`
+	RootCreated bool            `json:"root_created,omitempty"`
+	Entries     []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry is a created entry. Path is relative to the root, with
+// forward slashes. Files carry the SHA-256 of the content they were written
+// with and symlinks their target, to tell whether they changed since.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	SHA256 string `json:"sha256,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// Manifest entry kinds.
+const (
+	manifestDir     = "dir"
+	manifestFile    = "file"
+	manifestSymlink = "symlink"
+)
+
+// manifestEntry describes what op created under root.
+func manifestEntry(root string, op Operation) ManifestEntry {
+	rel, _ := filepath.Rel(root, op.Path)
+	entry := ManifestEntry{Path: filepath.ToSlash(rel)}
+	switch op.Kind {
+	case OpCreateDir:
+		entry.Kind = manifestDir
+	case OpCreateSymlink:
+		entry.Kind = manifestSymlink
+		entry.Target = op.Target
+	default:
+		entry.Kind = manifestFile
+		sum := sha256.Sum256(op.Content)
+		entry.SHA256 = hex.EncodeToString(sum[:])
+	}
+	return entry
+}
+
+// ReadManifest reads the manifest of rootDir, returning ErrNoManifest if
+// there is none.
+func ReadManifest(rootDir string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(rootDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoManifest
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", ManifestPath(rootDir), err)
+	}
+	if manifest.Version > manifestVersion {
+		return nil, fmt.Errorf("manifest %s has version %d, this mkproj reads up to %d", ManifestPath(rootDir), manifest.Version, manifestVersion)
+	}
+	return &manifest, nil
+}
+
+// writeManifest writes manifest to rootDir, replacing the previous one, and
+// returns the paths it created: the manifest directory, if it was missing,
+// and the manifest itself, if there was none.
+func writeManifest(rootDir string, manifest *Manifest) ([]string, error) {
+	var created []string
+	dir := filepath.Join(rootDir, ManifestDir)
+	if err := os.Mkdir(dir, 0755); err == nil {
+		created = append(created, dir)
+	} else if !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return created, err
+	}
+	path := ManifestPath(rootDir)
+	if !pathExists(path) {
+		created = append(created, path)
+	}
+	return created, os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// KeptEntry is a manifest entry that Undo left in place, and why.
+type KeptEntry struct {
+	Path   string
+	Reason string
+}
+
+// UndoError is returned by Undo when some entries were left in place. They
+// stay listed in the manifest.
+type UndoError struct {
+	Kept []KeptEntry
+}
+
+// Error lists every kept entry on its own line.
+func (e *UndoError) Error() string {
+	var b strings.Builder
+	b.WriteString("kept " + text.Plural(len(e.Kept), "entry", "entries") + ":")
+	for _, kept := range e.Kept {
+		fmt.Fprintf(&b, "\n  %s: %s", kept.Path, kept.Reason)
+	}
+	return b.String()
+}
+
+// Undo removes the entries listed in the manifest of rootDir, newest first,
+// as long as they are unchanged: files must still have the content they were
+// created with, symlinks their target, and directories must be empty once
+// the entries inside them are gone. Entries already removed are ignored.
+// When everything is gone, so are the manifest and, if the build created it,
+// the root; otherwise the manifest keeps the entries that are left and a
+// *UndoError lists them. With dryRun, it only prints what it would remove.
+func Undo(rootDir string, dryRun bool) error {
+	manifest, err := ReadManifest(rootDir)
+	if err != nil {
+		return err
+	}
+	confine, err := newConfiner(rootDir)
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	var kept []ManifestEntry
+	var undoErr UndoError
+	removed := map[string]bool{} // entries removed or, in a dry run, that would be
+	for i := len(manifest.Entries) - 1; i >= 0; i-- {
+		entry := manifest.Entries[i]
+		path := filepath.Join(rootDir, filepath.FromSlash(entry.Path))
+		reason := ""
+		if err := confine.check(path); err != nil {
+			reason = err.Error()
+		} else {
+			reason = changedReason(path, entry, removed)
+		}
+		switch {
+		case reason == "gone":
+			continue
+		case reason != "":
+			kept = append([]ManifestEntry{entry}, kept...)
+			undoErr.Kept = append(undoErr.Kept, KeptEntry{Path: path, Reason: reason})
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				kept = append([]ManifestEntry{entry}, kept...)
+				undoErr.Kept = append(undoErr.Kept, KeptEntry{Path: path, Reason: err.Error()})
+				continue
+			}
+		}
+		removed[path] = true
+		fmt.Printf("%s %s: %s\n", verb, entry.Kind, path)
+	}
+	if dryRun {
+		if len(undoErr.Kept) > 0 {
+			return &undoErr
+		}
+		return nil
+	}
+	if len(kept) > 0 {
+		manifest.Entries = kept
+		if _, err := writeManifest(rootDir, manifest); err != nil {
+			return err
+		}
+		return &undoErr
+	}
+	if err := os.Remove(ManifestPath(rootDir)); err != nil {
+		return err
+	}
+	// Other files in the manifest directory are not ours to remove
+	os.Remove(filepath.Join(rootDir, ManifestDir))
+	if manifest.RootCreated {
+		if err := os.Remove(rootDir); err == nil {
+			fmt.Printf("%s root directory: %s\n", verb, rootDir)
+		}
+	}
+	return nil
+}
+
+// changedReason tells why the entry at path no longer is what the manifest
+// says, "gone" if it does not exist, or "" if it can be removed. Entries in
+// removed count as gone when checking whether a directory is empty.
+func changedReason(path string, entry ManifestEntry, removed map[string]bool) string {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "gone"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	switch entry.Kind {
+	case manifestDir:
+		if !info.IsDir() {
+			return "is no longer a directory"
+		}
+		children, err := os.ReadDir(path)
+		if err != nil {
+			return err.Error()
+		}
+		for _, child := range children {
+			if !removed[filepath.Join(path, child.Name())] {
+				return "directory still contains other entries"
+			}
+		}
+	case manifestSymlink:
+		if target, err := os.Readlink(path); err != nil || target != entry.Target {
+			return "is no longer a link to " + entry.Target
+		}
+	case manifestFile:
+		if !info.Mode().IsRegular() {
+			return "is no longer a regular file"
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err.Error()
+		}
+		if sum != entry.SHA256 {
+			return "file was modified"
+		}
+	default:
+		return fmt.Sprintf("unknown kind %q", entry.Kind)
+	}
+	return ""
+}
+
+// fileSHA256 returns the hex SHA-256 of the content of the file at path.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,209 @@
+package project
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestBuildProjectStructure_Manifest tests that the manifest lists the
+// entries a build created, and only those.
+func TestBuildProjectStructure_Manifest(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(rootDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(rootDir, "empty.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	lines := []string{
+		"src",
+		"-main.go <<EOF",
+		"package main",
+		"EOF",
+		"docs",
+		"-README.md",
+		"empty.txt <<EOF",
+		"filled",
+		"EOF",
+	}
+	if err := BuildProjectStructure(lines, rootDir, Options{Manifest: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	manifest, err := ReadManifest(rootDir)
+	if err != nil {
+		t.Fatalf("ReadManifest(%q) unexpected error: %v", rootDir, err)
+	}
+	want := []ManifestEntry{
+		{Path: "src/main.go", Kind: "file", SHA256: "df1d036cbbf3df46e2045071e082245ece204c7f53ecf0a4e022bff9bb228f47"},
+		{Path: "docs", Kind: "dir"},
+		{Path: "docs/README.md", Kind: "file", SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+	if manifest.RootCreated || len(manifest.Entries) != len(want) {
+		t.Fatalf("ReadManifest(%q) = %+v; want entries %+v", rootDir, manifest, want)
+	}
+	for i, entry := range manifest.Entries {
+		if entry != want[i] {
+			t.Errorf("Manifest entry %d = %+v; want %+v", i, entry, want[i])
+		}
+	}
+
+	// A build that creates nothing keeps the manifest of the previous one
+	if err := BuildProjectStructure(lines, rootDir, Options{Manifest: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again, err := ReadManifest(rootDir); err != nil || len(again.Entries) != len(want) {
+		t.Errorf("ReadManifest(%q) after an empty build = %+v, %v; want the previous entries", rootDir, again, err)
+	}
+}
+
+// TestUndo tests that Undo removes unchanged entries and keeps modified ones.
+func TestUndo(t *testing.T) {
+	parent := t.TempDir()
+	rootDir := filepath.Join(parent, "project")
+	lines := []string{
+		"src",
+		"-main.go <<EOF",
+		"package main",
+		"EOF",
+		"-util.go",
+		"docs",
+		"-README.md <<EOF",
+		"# Docs",
+		"EOF",
+	}
+	if err := BuildProjectStructure(lines, rootDir, Options{Manifest: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Modify a file and add one of our own
+	modified := filepath.Join(rootDir, "docs", "README.md")
+	if err := os.WriteFile(modified, []byte("# Changed\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	ours := filepath.Join(rootDir, "src", "notes.txt")
+	if err := os.WriteFile(ours, []byte("mine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := Undo(rootDir, true); err == nil {
+		t.Errorf("Undo(%q, true) = nil; want an *UndoError", rootDir)
+	}
+	validateStructure(t, nil, []string{filepath.Join(rootDir, "src", "main.go")})
+
+	err := Undo(rootDir, false)
+	var undoErr *UndoError
+	if !errors.As(err, &undoErr) || len(undoErr.Kept) != 3 {
+		t.Fatalf("Undo(%q, false) = %v; want 3 kept entries", rootDir, err)
+	}
+	for _, path := range []string{filepath.Join(rootDir, "src", "main.go"), filepath.Join(rootDir, "src", "util.go")} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+	validateStructure(t, nil, []string{modified, ours})
+
+	// Once the user's changes are gone, a second undo finishes the job
+	if err := os.Remove(ours); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := os.Remove(modified); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := Undo(rootDir, false); err != nil {
+		t.Fatalf("Undo(%q, false) unexpected error: %v", rootDir, err)
+	}
+	if _, err := os.Stat(rootDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the root created by the build to be removed")
+	}
+	if err := Undo(rootDir, false); !errors.Is(err, ErrNoManifest) {
+		t.Errorf("Undo(%q, false) = %v; want %v", rootDir, err, ErrNoManifest)
+	}
+}
+
+// TestUndo_ReplacedEntries tests that entries replaced under the overwrite
+// and backup policies are not in the manifest, so Undo leaves them.
+func TestUndo_ReplacedEntries(t *testing.T) {
+	for _, policy := range []ConflictPolicy{ConflictOverwrite, ConflictBackup} {
+		rootDir := t.TempDir()
+		config := filepath.Join(rootDir, "config.yaml")
+		if err := os.WriteFile(config, []byte("old: true\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		lines := []string{
+			"config.yaml <<EOF",
+			"new: true",
+			"EOF",
+			"main.go",
+		}
+		if err := BuildProjectStructure(lines, rootDir, Options{OnConflict: policy, Manifest: true}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", policy, err)
+		}
+		manifest, err := ReadManifest(rootDir)
+		if err != nil {
+			t.Fatalf("%s: ReadManifest(%q) unexpected error: %v", policy, rootDir, err)
+		}
+		if len(manifest.Entries) != 1 || manifest.Entries[0].Path != "main.go" {
+			t.Errorf("%s: manifest entries = %+v; want only main.go", policy, manifest.Entries)
+		}
+
+		if err := Undo(rootDir, false); err != nil {
+			t.Fatalf("%s: Undo(%q, false) unexpected error: %v", policy, rootDir, err)
+		}
+		if got, err := os.ReadFile(config); err != nil || string(got) != "new: true\n" {
+			t.Errorf("%s: config.yaml = %q, %v; want it left as the build wrote it", policy, got, err)
+		}
+		if _, err := os.Lstat(filepath.Join(rootDir, "main.go")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected main.go to be removed", policy)
+		}
+		if policy == ConflictBackup {
+			validateStructure(t, nil, []string{config + ".bak"})
+		}
+	}
+}
+
+// TestUndo_Symlinks tests that Undo removes links that still point where
+// they were created to, and refuses manifest paths outside the root.
+func TestUndo_Symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	rootDir := t.TempDir()
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim.txt")
+	if err := os.WriteFile(victim, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := BuildProjectStructure([]string{"same -> a", "moved -> b"}, rootDir, Options{Manifest: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Remove(filepath.Join(rootDir, "moved")); err != nil {
+		t.Fatalf("Failed to remove link: %v", err)
+	}
+	if err := os.Symlink("c", filepath.Join(rootDir, "moved")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	manifest, err := ReadManifest(rootDir)
+	if err != nil {
+		t.Fatalf("ReadManifest(%q) unexpected error: %v", rootDir, err)
+	}
+	rel, _ := filepath.Rel(rootDir, victim)
+	manifest.Entries = append(manifest.Entries, ManifestEntry{Path: filepath.ToSlash(rel), Kind: "file", SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"})
+	if _, err := writeManifest(rootDir, manifest); err != nil {
+		t.Fatalf("writeManifest(%q) unexpected error: %v", rootDir, err)
+	}
+
+	err = Undo(rootDir, false)
+	var undoErr *UndoError
+	if !errors.As(err, &undoErr) || len(undoErr.Kept) != 2 {
+		t.Fatalf("Undo(%q, false) = %v; want 2 kept entries", rootDir, err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootDir, "same")); !os.IsNotExist(err) {
+		t.Errorf("Expected the unchanged link to be removed")
+	}
+	validateStructure(t, nil, []string{victim})
+}
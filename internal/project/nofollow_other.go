@@ -0,0 +1,7 @@
+//go:build !unix
+
+package project
+
+// oNoFollow is not available here; callers check for a symlink with Lstat
+// before opening.
+const oNoFollow = 0
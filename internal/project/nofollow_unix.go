@@ -0,0 +1,9 @@
+//go:build unix
+
+package project
+
+import "syscall"
+
+// oNoFollow makes opening a file fail when the last element of its path is
+// a symlink.
+const oNoFollow = syscall.O_NOFOLLOW
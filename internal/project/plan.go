@@ -0,0 +1,210 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/text"
+)
+
+// OpKind is the kind of filesystem change a planned operation performs.
+type OpKind int
+
+const (
+	// OpCreateDir creates a directory.
+	OpCreateDir OpKind = iota
+	// OpCreateFile creates a file, empty unless the operation carries content.
+	OpCreateFile
+	// OpCreateSymlink creates a symbolic link to the operation's target.
+	OpCreateSymlink
+)
+
+// String returns the short verb used when printing a plan.
+func (k OpKind) String() string {
+	switch k {
+	case OpCreateDir:
+		return "mkdir"
+	case OpCreateFile:
+		return "create"
+	case OpCreateSymlink:
+		return "link"
+	}
+	return "unknown"
+}
+
+// Operation is a single filesystem change derived from a structure line.
+// Mode holds the permission bits to set, or 0 to keep the default, and
+// Target where a symlink points. Conflict explains why the entry that exists
+// at Path is in the way, when it is.
+type Operation struct {
+	Kind     OpKind
+	Path     string
+	Line     int
+	Exists   bool
+	Conflict string
+	Content  []byte
+	Mode     fs.FileMode
+	Target   string
+}
+
+// Plan is the ordered list of operations needed to build a structure.
+type Plan struct {
+	Root       string
+	RootExists bool
+	Operations []Operation
+}
+
+// Options tunes how a structure is planned and built.
+type Options struct {
+	// BaseDir is the directory that content sources ("name < path") are
+	// resolved against, and that they must stay inside. The working
+	// directory is used when empty.
+	BaseDir string
+	// Format is the syntax of the lines; it is detected when empty.
+	Format spec.Format
+	// OnConflict is what to do about existing entries in the way;
+	// ConflictSkip is used when empty.
+	OnConflict ConflictPolicy
+	// Prompt is asked how to resolve each conflict under ConflictPrompt, and
+	// returns ConflictSkip, ConflictOverwrite or ConflictBackup.
+	Prompt func(Conflict) (ConflictPolicy, error)
+	// Atomic keeps a failed build from leaving anything behind. A new root
+	// is built in a staging directory next to it and renamed into place; in
+	// an existing root every change is recorded and undone on failure.
+	Atomic bool
+	// Manifest records the entries the build creates in ManifestPath, so
+	// that Undo can remove them.
+	Manifest bool
+	// Vars, when not nil, are the template variables content sources are
+	// rendered with, unless they are marked literal.
+	Vars render.Vars
+}
+
+// PlanProjectStructure works out every directory and file the lines describe
+// without touching the filesystem, other than checking what already exists
+// and reading content sources. Structures that do not parse are reported as a
+// spec.ErrorList, and unreadable sources as a *SourceError.
+func PlanProjectStructure(lines []string, rootDir string, opts Options) (*Plan, error) {
+	nodes, err := spec.ParseAs(lines, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Root: rootDir, RootExists: pathExists(rootDir)}
+	err = spec.Walk(nodes, func(path string, node *spec.Node) error {
+		fullPath := filepath.Join(rootDir, path)
+		op := Operation{Kind: OpCreateDir, Path: fullPath, Line: node.Line, Exists: pathExists(fullPath), Mode: node.Mode}
+		switch node.Kind {
+		case spec.Symlink:
+			op.Kind = OpCreateSymlink
+			op.Target = node.Target
+		case spec.File:
+			op.Kind = OpCreateFile
+			content, err := loadContent(node, opts)
+			if err != nil {
+				return err
+			}
+			op.Content = content
+		}
+		if op.Exists {
+			op.Conflict = conflictReason(op)
+		}
+		plan.Operations = append(plan.Operations, op)
+		return nil
+	})
+	return plan, err
+}
+
+// Conflicts returns the conflicts of the plan, not yet resolved.
+func (p *Plan) Conflicts() []Conflict {
+	var conflicts []Conflict
+	for _, op := range p.Operations {
+		if op.Conflict != "" {
+			conflicts = append(conflicts, Conflict{Path: op.Path, Line: op.Line, Reason: op.Conflict})
+		}
+	}
+	return conflicts
+}
+
+// Print writes a human readable version of the plan to w.
+func (p *Plan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Planned operations for %s:\n", p.Root)
+	if !p.RootExists {
+		fmt.Fprintf(w, "  %-6s %s\n", OpCreateDir, p.Root)
+	}
+	dirs, files, links, existing, conflicts := 0, 0, 0, 0, 0
+	for _, op := range p.Operations {
+		note := ""
+		if len(op.Content) > 0 {
+			note = fmt.Sprintf(" (%d bytes)", len(op.Content))
+		}
+		if op.Kind == OpCreateSymlink {
+			note = " -> " + op.Target
+		}
+		if op.Mode != 0 {
+			note += fmt.Sprintf(" (mode %04o)", uint32(op.Mode))
+		}
+		if op.Conflict != "" {
+			note += " (conflict: " + op.Conflict + ")"
+			conflicts++
+		} else if op.Exists {
+			note += " (already exists)"
+			existing++
+		}
+		switch op.Kind {
+		case OpCreateDir:
+			dirs++
+		case OpCreateSymlink:
+			links++
+		default:
+			files++
+		}
+		fmt.Fprintf(w, "  %-6s %s%s\n", op.Kind, op.Path, note)
+	}
+	counts := text.Plural(dirs, "directory", "directories") + ", " + text.Plural(files, "file", "files")
+	if links > 0 {
+		counts += ", " + text.Plural(links, "symlink", "symlinks")
+	}
+	counts += "; " + text.Plural(existing, "already exists", "already exist")
+	if conflicts > 0 {
+		counts += ", " + text.Plural(conflicts, "conflicts", "conflict")
+	}
+	fmt.Fprintln(w, counts)
+}
+
+// loadContent returns the body of a file node, reading it from its source
+// path, inside the base directory, and rendering it when it has one.
+func loadContent(node *spec.Node, opts Options) ([]byte, error) {
+	if node.Source == "" {
+		if node.Content == "" {
+			return nil, nil
+		}
+		return []byte(node.Content), nil
+	}
+	source, err := resolveSource(opts.BaseDir, node.Source)
+	if err != nil {
+		return nil, &SourceError{Path: node.Source, Line: node.Line, Err: err}
+	}
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, &SourceError{Path: source, Line: node.Line, Err: err}
+	}
+	if opts.Vars == nil || node.Literal {
+		return content, nil
+	}
+	rendered, err := render.Text(string(content), opts.Vars)
+	if err != nil {
+		return nil, &SourceError{Path: node.Source, Line: node.Line, Err: err}
+	}
+	return []byte(rendered), nil
+}
+
+// pathExists reports whether something is present at path.
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -1,63 +1,463 @@
 package project
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/jobehi/mkproj/internal/text"
 )
 
-// BuildProjectStructure builds the project structure from lines
-func BuildProjectStructure(lines []string, rootDir string) {
+// BuildProjectStructure builds the project structure from lines. Nothing is
+// created if the lines do not parse; otherwise it keeps going past individual
+// failures and reports them all in a *BuildError. Existing directories are
+// reused, and other existing entries in the way are resolved by
+// opts.OnConflict; under ConflictFail a *ConflictError is returned before
+// anything is created. With opts.Atomic, a failure leaves the filesystem as
+// it was. With opts.Manifest, the entries created are recorded for Undo.
+func BuildProjectStructure(lines []string, rootDir string, opts Options) error {
+	plan, err := PlanProjectStructure(lines, rootDir, opts)
+	if err != nil {
+		return err
+	}
+	policy := opts.OnConflict
+	if policy == "" {
+		policy = ConflictSkip
+	}
+	if policy == ConflictPrompt && opts.Prompt == nil {
+		return fmt.Errorf("the %s conflict policy needs a way to ask", policy)
+	}
+	if conflicts := plan.Conflicts(); policy == ConflictFail && len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
 	fmt.Println("Building project structure... Hold on tight! 🛠️")
-	err := os.MkdirAll(rootDir, 0755)
+	b := &builder{policy: policy, prompt: opts.Prompt, journal: opts.Atomic, manifest: opts.Manifest}
+	if opts.Atomic && !plan.RootExists {
+		err = b.buildStaged(lines, rootDir, opts)
+	} else {
+		err = b.buildInPlace(plan)
+	}
 	if err != nil {
-		fmt.Printf("Error creating root directory %s: %v\n", rootDir, err)
-		return
+		return err
 	}
-	pathStack := []string{rootDir}
-	for _, line := range lines {
-		content := strings.TrimRight(line, "\r\n")
-		if content == "" {
-			continue
+	if pathExists(rootDir) {
+		displayFinalStructure(rootDir)
+	}
+	if len(b.conflicts) > 0 {
+		fmt.Printf("\n%s with existing entries:\n", text.Plural(len(b.conflicts), "conflict", "conflicts"))
+		for _, conflict := range b.conflicts {
+			fmt.Printf("  %s\n", conflict)
 		}
-		depth := countLeadingDashes(content)
-		if depth < 0 {
-			depth = 0
+	}
+	if len(b.failures) > 0 {
+		return &BuildError{Failures: b.failures, RolledBack: b.rolledBack}
+	}
+	return nil
+}
+
+// builder carries out the operations of a plan. When journal is set it
+// records every change it makes, so that they can be undone; rolledBack is
+// set once they all were.
+type builder struct {
+	policy   ConflictPolicy
+	prompt   func(Conflict) (ConflictPolicy, error)
+	journal  bool
+	manifest bool
+
+	confine    *confiner
+	created    []ManifestEntry
+	changes    []change
+	discard    []string // entries moved aside by overwrites, removed on success
+	failures   []Failure
+	conflicts  []Conflict
+	rolledBack bool
+}
+
+// change is a journaled filesystem change: an entry created at path, an
+// empty file at path that was written to when filled is set, or an existing
+// entry moved from path to movedTo.
+type change struct {
+	path    string
+	line    int
+	filled  bool
+	movedTo string
+}
+
+// buildInPlace builds the plan directly under its root, which it creates if
+// needed. When journaling, any failure undoes everything done so far.
+func (b *builder) buildInPlace(plan *Plan) error {
+	if err := os.MkdirAll(plan.Root, 0755); err != nil {
+		return &RootError{Path: plan.Root, Err: err}
+	}
+	confine, err := newConfiner(plan.Root)
+	if err != nil {
+		return &RootError{Path: plan.Root, Err: err}
+	}
+	b.confine = confine
+	b.apply(plan.Operations)
+	if !b.journal || len(b.failures) == 0 {
+		// Without a journal, whatever was created is listed even if some
+		// entries failed, so that it can still be undone
+		b.writeManifest(plan.Root, !plan.RootExists)
+	}
+	if !b.journal {
+		return nil
+	}
+	if len(b.failures) > 0 {
+		b.rollback()
+		return nil
+	}
+	for _, path := range b.discard {
+		if err := os.RemoveAll(path); err != nil {
+			b.failures = append(b.failures, newFailure(path, 0, err))
+		}
+	}
+	return nil
+}
+
+// buildStaged builds the structure in a hidden directory next to rootDir,
+// which does not exist yet, and renames it into place once every entry has
+// been created. On failure the staging directory is removed, along with the
+// parent directories created for it.
+func (b *builder) buildStaged(lines []string, rootDir string, opts Options) error {
+	parent := filepath.Dir(filepath.Clean(rootDir))
+	parents := missingDirs(parent)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		b.removeDirs(parents)
+		return &RootError{Path: rootDir, Err: err}
+	}
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(rootDir)+".staging-")
+	if err != nil {
+		b.removeDirs(parents)
+		return &RootError{Path: rootDir, Err: err}
+	}
+	fmt.Printf("Staging in %s\n", staging)
+	plan, err := PlanProjectStructure(lines, staging, opts)
+	if err == nil {
+		b.confine, err = newConfiner(staging)
+	}
+	if err == nil {
+		b.apply(plan.Operations)
+		if len(b.failures) == 0 {
+			b.writeManifest(staging, true)
 		}
-		if depth > len(pathStack)-1 {
-			depth = len(pathStack) - 1
+		if len(b.failures) == 0 {
+			// MkdirTemp makes private directories; give the root the usual mode
+			err = os.Chmod(staging, 0755)
 		}
-		pathStack = pathStack[:depth+1]
-		parentDir := pathStack[len(pathStack)-1]
-		isFile, name := isFileLine(content)
-		if name == "" {
-			fmt.Printf("Invalid name at line: %s\n", content)
+	}
+	if err == nil && len(b.failures) == 0 {
+		err = os.Rename(staging, rootDir)
+	}
+	if err != nil || len(b.failures) > 0 {
+		b.rolledBack = true
+		if removeErr := os.RemoveAll(staging); removeErr != nil {
+			b.failures = append(b.failures, newFailure(staging, 0, fmt.Errorf("cannot undo: %w", removeErr)))
+			b.rolledBack = false
+		}
+		b.removeDirs(parents)
+		if err != nil {
+			return &RootError{Path: rootDir, Err: err}
+		}
+		return nil
+	}
+	fmt.Printf("Moved %s into place at %s\n", staging, rootDir)
+	return nil
+}
+
+// missingDirs returns dir and each of its parents that does not exist yet,
+// deepest first.
+func missingDirs(dir string) []string {
+	var missing []string
+	for !pathExists(dir) {
+		missing = append(missing, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return missing
+}
+
+// removeDirs removes the directories a failed build created around its root,
+// deepest first. Those that cannot be removed are failures, and keep the
+// build from counting as rolled back.
+func (b *builder) removeDirs(dirs []string) {
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			b.failures = append(b.failures, newFailure(dir, 0, fmt.Errorf("cannot undo: %w", err)))
+			b.rolledBack = false
+		}
+	}
+}
+
+// apply carries out operations in order, keeping going past failures.
+// Operations that would reach outside the root fail, and so does everything
+// below them.
+func (b *builder) apply(operations []Operation) {
+	var dirModes []Operation // applied last, so restrictive modes do not block children
+	var skipped []string     // directories left as they were, with everything inside
+	for _, op := range operations {
+		if insideAny(op.Path, skipped) {
+			if op.Kind == OpCreateDir {
+				skipped = append(skipped, op.Path)
+			}
+			continue
+		}
+		if err := b.confine.check(op.Path); err != nil {
+			b.fail(op, err)
+			if op.Kind == OpCreateDir {
+				skipped = append(skipped, op.Path)
+			}
 			continue
 		}
-		fullPath := filepath.Join(parentDir, name)
-		if isFile {
-			file, err := os.Create(fullPath)
+		verb := "Created"
+		if op.Conflict != "" {
+			conflict := Conflict{Path: op.Path, Line: op.Line, Reason: op.Conflict, Resolution: b.policy}
+			err := b.resolveConflict(&conflict, op)
+			if err != nil {
+				b.fail(op, err)
+			} else {
+				b.conflicts = append(b.conflicts, conflict)
+			}
+			if err != nil || conflict.Resolution == ConflictSkip {
+				if op.Kind == OpCreateDir {
+					skipped = append(skipped, op.Path)
+				}
+				continue
+			}
+			if conflict.Resolution == ConflictOverwrite {
+				verb = "Updated"
+			}
+		} else if op.Exists && op.Kind != OpCreateFile {
+			// The directory or link is already what the structure wants
+			continue
+		}
+		switch op.Kind {
+		case OpCreateFile:
+			// Existing files left at this point are empty or already right
+			info, statErr := os.Lstat(op.Path)
+			if statErr == nil && info.Mode()&fs.ModeSymlink != 0 {
+				b.fail(op, ErrSymlink)
+				continue
+			}
+			file, err := openFile(op.Path, statErr == nil)
+			if err != nil {
+				b.fail(op, err)
+				continue
+			}
+			b.addCreated(op)
+			if statErr != nil {
+				b.record(change{path: op.Path, line: op.Line})
+			} else if info.Size() == 0 {
+				b.record(change{path: op.Path, line: op.Line, filled: true})
+			}
+			if statErr == nil && len(op.Content) > 0 {
+				// An empty file filled with its declared content
+				verb = "Updated"
+			}
+			_, err = file.Write(op.Content)
+			if err == nil && op.Mode != 0 {
+				err = file.Chmod(op.Mode)
+			}
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
 			if err != nil {
-				fmt.Printf("Error creating file %s: %v\n", fullPath, err)
+				b.fail(op, err)
 				continue
 			}
-			file.Close()
-			fmt.Printf("Created file: %s\n", fullPath)
-		} else {
-			err := os.Mkdir(fullPath, 0755)
+			fmt.Printf("%s file: %s\n", verb, op.Path)
+		case OpCreateDir:
+			err := os.Mkdir(op.Path, 0755)
 			if err != nil {
-				fmt.Printf("Error creating directory %s: %v\n", fullPath, err)
+				b.fail(op, err)
 				continue
 			}
-			fmt.Printf("Created directory: %s\n", fullPath)
-			pathStack = append(pathStack, fullPath)
+			b.record(change{path: op.Path, line: op.Line})
+			b.addCreated(op)
+			if op.Mode != 0 {
+				dirModes = append(dirModes, op)
+			}
+			fmt.Printf("Created directory: %s\n", op.Path)
+		case OpCreateSymlink:
+			if err := os.Symlink(op.Target, op.Path); err != nil {
+				b.fail(op, err)
+				continue
+			}
+			b.record(change{path: op.Path, line: op.Line})
+			b.addCreated(op)
+			fmt.Printf("%s symlink: %s -> %s\n", verb, op.Path, op.Target)
+		}
+	}
+	for i := len(dirModes) - 1; i >= 0; i-- {
+		op := dirModes[i]
+		if err := chmod(op.Path, op.Mode); err != nil {
+			b.fail(op, err)
 		}
 	}
-	displayFinalStructure(rootDir)
 }
 
-// displayFinalStructure shows the final structure.
+// addCreated lists what op created for the manifest, unless its path was
+// taken before the build: an entry replaced under the overwrite or backup
+// policy is not the build's to remove.
+func (b *builder) addCreated(op Operation) {
+	if !op.Exists {
+		b.created = append(b.created, manifestEntry(b.confine.root, op))
+	}
+}
+
+// writeManifest lists the created entries in the manifest of root, if asked
+// to and there are any: a build that adds nothing leaves the previous
+// manifest for Undo.
+func (b *builder) writeManifest(root string, rootCreated bool) {
+	if !b.manifest || len(b.created) == 0 {
+		return
+	}
+	manifest := &Manifest{Version: manifestVersion, Created: time.Now().UTC(), RootCreated: rootCreated, Entries: b.created}
+	created, err := writeManifest(root, manifest)
+	for _, path := range created {
+		b.record(change{path: path})
+	}
+	if err != nil {
+		b.failures = append(b.failures, newFailure(ManifestPath(root), 0, err))
+	}
+}
+
+func (b *builder) fail(op Operation, err error) {
+	b.failures = append(b.failures, newFailure(op.Path, op.Line, err))
+}
+
+func (b *builder) record(c change) {
+	if b.journal {
+		b.changes = append(b.changes, c)
+	}
+}
+
+// move renames the entry at path to dest, journaling the move.
+func (b *builder) move(path, dest string, line int) error {
+	if err := os.Rename(path, dest); err != nil {
+		return err
+	}
+	b.record(change{path: path, line: line, movedTo: dest})
+	return nil
+}
+
+// rollback undoes the journaled changes in reverse order: created entries
+// are removed and moved ones put back. Directories are empty by the time
+// they are removed, since everything created in them came later, unless
+// something else was added to them meanwhile. Changes that cannot be undone
+// are failures, and keep the build from counting as rolled back.
+func (b *builder) rollback() {
+	fmt.Printf("Rolling back %s\n", text.Plural(len(b.changes), "change", "changes"))
+	b.rolledBack = true
+	for i := len(b.changes) - 1; i >= 0; i-- {
+		c := b.changes[i]
+		var err error
+		switch {
+		case c.movedTo != "":
+			err = os.Rename(c.movedTo, c.path)
+		case c.filled:
+			err = os.Truncate(c.path, 0)
+		default:
+			err = os.Remove(c.path)
+		}
+		if err != nil {
+			b.failures = append(b.failures, newFailure(c.path, c.line, fmt.Errorf("cannot undo: %w", err)))
+			b.rolledBack = false
+		}
+	}
+	b.changes = nil
+}
+
+// resolveConflict applies the policy of conflict, asking first under
+// ConflictPrompt, and clears the way for op unless the entry is skipped. A
+// file in the way of a file is left for op to truncate, which keeps its
+// links and ownership, unless journaling: then it is moved aside so that it
+// can be restored, and removed once the build succeeds.
+func (b *builder) resolveConflict(conflict *Conflict, op Operation) error {
+	if conflict.Resolution == ConflictPrompt {
+		resolution, err := b.prompt(*conflict)
+		if err != nil {
+			return err
+		}
+		conflict.Resolution = resolution
+	}
+	switch conflict.Resolution {
+	case ConflictSkip:
+		return nil
+	case ConflictBackup:
+		conflict.Backup = backupPath(op.Path)
+		return b.move(op.Path, conflict.Backup, op.Line)
+	case ConflictOverwrite:
+		if b.journal {
+			if entries, err := os.ReadDir(op.Path); err == nil && len(entries) > 0 {
+				return errors.New("directory not empty")
+			}
+			aside := filepath.Join(filepath.Dir(op.Path), ".mkproj-replaced-"+filepath.Base(op.Path))
+			aside = backupPath(aside)
+			if err := b.move(op.Path, aside, op.Line); err != nil {
+				return err
+			}
+			b.discard = append(b.discard, aside)
+			return nil
+		}
+		if info, err := os.Lstat(op.Path); err == nil && op.Kind == OpCreateFile && info.Mode().IsRegular() {
+			return nil
+		}
+		return os.Remove(op.Path)
+	}
+	return fmt.Errorf("cannot resolve a conflict with the %s policy", conflict.Resolution)
+}
+
+// openFile opens the file at path for writing without following a symlink
+// in its place. A new file must not exist yet, and an existing one is
+// truncated.
+func openFile(path string, exists bool) (*os.File, error) {
+	flag := os.O_WRONLY | oNoFollow
+	if exists {
+		flag |= os.O_TRUNC
+	} else {
+		flag |= os.O_CREATE | os.O_EXCL
+	}
+	return os.OpenFile(path, flag, 0666)
+}
+
+// chmod sets the permission bits of path, refusing to follow a symlink in
+// its place.
+func chmod(path string, mode fs.FileMode) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return ErrSymlink
+	}
+	return os.Chmod(path, mode)
+}
+
+// insideAny reports whether path is below one of dirs.
+func insideAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyManifest reports whether the manifest is all there is in dir.
+func onlyManifest(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) == 1 && entries[0].Name() == filepath.Base(ManifestPath(""))
+}
+
+// displayFinalStructure shows the final structure, without the manifest.
 func displayFinalStructure(rootDir string) {
 	fmt.Println("\nFinal Project Structure:")
 	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
@@ -66,6 +466,10 @@ func displayFinalStructure(rootDir string) {
 			return err
 		}
 		relativePath, _ := filepath.Rel(rootDir, path)
+		if relativePath == ManifestDir && info.IsDir() && onlyManifest(path) {
+			// The manifest is not part of the structure
+			return filepath.SkipDir
+		}
 		if relativePath != "." {
 			depth := strings.Count(relativePath, string(os.PathSeparator))
 			fmt.Printf("%s%s\n", strings.Repeat("  ", depth), info.Name())
@@ -76,33 +480,3 @@ func displayFinalStructure(rootDir string) {
 		fmt.Printf("Error walking the path %s: %v\n", rootDir, err)
 	}
 }
-
-// countLeadingDashes counts the number of leading dashes.
-func countLeadingDashes(s string) int {
-	count := 0
-	for _, char := range s {
-		if char == '-' {
-			count++
-		} else if char == ' ' || char == '\t' {
-			continue
-		} else {
-			break
-		}
-	}
-	return count
-}
-
-// isFileLine checks if a line represents a file.
-func isFileLine(line string) (bool, string) {
-	name := strings.TrimLeft(line, "-")
-	name = strings.TrimSpace(name)
-	isFile := false
-	if strings.HasSuffix(name, ":file") {
-		isFile = true
-		name = strings.TrimSuffix(name, ":file")
-		name = strings.TrimSpace(name)
-	} else if strings.Contains(name, ".") {
-		isFile = true
-	}
-	return isFile, name
-}
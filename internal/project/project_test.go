@@ -1,9 +1,16 @@
 package project
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/spec"
 )
 
 // TestBuildProjectStructure_Basic tests the creation of a basic project structure.
@@ -19,7 +26,7 @@ func TestBuildProjectStructure_Basic(t *testing.T) {
 	}
 
 	// Call BuildProjectStructure
-	BuildProjectStructure(lines, rootDir)
+	BuildProjectStructure(lines, rootDir, Options{})
 
 	// Validate the expected directory structure
 	expectedDirs := []string{
@@ -46,7 +53,7 @@ func TestBuildProjectStructure_FileWithoutExtension(t *testing.T) {
 	}
 
 	// Call BuildProjectStructure
-	BuildProjectStructure(lines, rootDir)
+	BuildProjectStructure(lines, rootDir, Options{})
 
 	// Validate the expected directory structure
 	expectedDirs := []string{
@@ -68,7 +75,7 @@ func TestBuildProjectStructure_EmptyInput(t *testing.T) {
 	lines := []string{}
 
 	// Call BuildProjectStructure
-	BuildProjectStructure(lines, rootDir)
+	BuildProjectStructure(lines, rootDir, Options{})
 
 	// Ensure no directories or files were created
 	if _, err := os.Stat(rootDir); os.IsNotExist(err) {
@@ -109,3 +116,763 @@ func validateStructure(t *testing.T, expectedDirs []string, expectedFiles []stri
 		}
 	}
 }
+
+// TestPlanProjectStructure tests that planning resolves paths and flags existing entries.
+func TestPlanProjectStructure(t *testing.T) {
+	rootDir := setupTestRootDir(t)
+	defer os.RemoveAll(rootDir) // Clean up after the test
+
+	if err := os.Mkdir(filepath.Join(rootDir, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	lines := []string{
+		"src",
+		"-main.go",
+		"docs",
+		"-README:file",
+	}
+
+	plan, err := PlanProjectStructure(lines, rootDir, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Operation{
+		{Kind: OpCreateDir, Path: filepath.Join(rootDir, "src"), Line: 1, Exists: true},
+		{Kind: OpCreateFile, Path: filepath.Join(rootDir, "src", "main.go"), Line: 2},
+		{Kind: OpCreateDir, Path: filepath.Join(rootDir, "docs"), Line: 3},
+		{Kind: OpCreateFile, Path: filepath.Join(rootDir, "docs", "README"), Line: 4},
+	}
+	if len(plan.Operations) != len(expected) {
+		t.Fatalf("Expected %d operations, got %d", len(expected), len(plan.Operations))
+	}
+	for i, op := range plan.Operations {
+		if op.Kind != expected[i].Kind || op.Path != expected[i].Path || op.Line != expected[i].Line || op.Exists != expected[i].Exists {
+			t.Errorf("Operation %d = %+v; want %+v", i, op, expected[i])
+		}
+	}
+
+	// Planning must not create anything
+	if _, err := os.Stat(filepath.Join(rootDir, "docs")); !os.IsNotExist(err) {
+		t.Errorf("Expected planning to leave the filesystem untouched")
+	}
+}
+
+// TestMessages_Singular tests that counts of one are not written as plurals.
+func TestMessages_Singular(t *testing.T) {
+	rootDir := t.TempDir()
+	for name, content := range map[string]string{"notes.txt": "old\n", "README.md": ""} {
+		if err := os.WriteFile(filepath.Join(rootDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	plan, err := PlanProjectStructure([]string{"src", "notes.txt <<EOF", "new", "EOF", "README.md", "latest -> src"}, rootDir, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var out strings.Builder
+	plan.Print(&out)
+
+	failure := Failure{Path: "src", Line: 1, Err: os.ErrExist}
+	conflict := Conflict{Path: "notes.txt", Line: 3, Reason: "file has other content"}
+	messages := map[string]string{
+		out.String(): "1 directory, 2 files, 1 symlink; 1 already exists, 1 conflicts\n",
+		(&BuildError{Failures: []Failure{failure}}).Error():       "failed to create 1 entry:",
+		(&ConflictError{Conflicts: []Conflict{conflict}}).Error(): "1 existing entry conflicts with the structure:",
+		(&UndoError{Kept: []KeptEntry{{Path: "src"}}}).Error():    "kept 1 entry:",
+	}
+	for got, want := range messages {
+		if !strings.Contains(got, want) {
+			t.Errorf("Message %q does not contain %q", got, want)
+		}
+	}
+}
+
+// tooLongName is a valid structure name that no filesystem accepts.
+var tooLongName = strings.Repeat("x", 300)
+
+// TestBuildProjectStructure_ReportsFailures tests that failed entries are returned in a BuildError.
+func TestBuildProjectStructure_ReportsFailures(t *testing.T) {
+	rootDir := setupTestRootDir(t)
+	defer os.RemoveAll(rootDir) // Clean up after the test
+
+	lines := []string{
+		"src",
+		tooLongName,
+		"docs",
+		"-guide.md",
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{})
+
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("Expected a *BuildError, got %v", err)
+	}
+	if len(buildErr.Failures) != 1 {
+		t.Fatalf("Expected 1 failure, got %d: %v", len(buildErr.Failures), buildErr)
+	}
+	if failure := buildErr.Failures[0]; failure.Line != 2 || failure.Path != filepath.Join(rootDir, tooLongName) {
+		t.Errorf("Expected a failure for the long name at line 2, got %v", failure)
+	}
+
+	// Entries after the failures are still created
+	validateStructure(t, []string{filepath.Join(rootDir, "src")}, []string{filepath.Join(rootDir, "docs", "guide.md")})
+}
+
+// TestBuildProjectStructure_ParseError tests that nothing is created when the structure does not parse.
+func TestBuildProjectStructure_ParseError(t *testing.T) {
+	rootDir := setupTestRootDir(t)
+	defer os.RemoveAll(rootDir) // Clean up after the test
+
+	lines := []string{
+		"src",
+		"---",
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{})
+
+	var parseErr *spec.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 2 {
+		t.Fatalf("Expected a parse error at line 2, got %v", err)
+	}
+	files, _ := os.ReadDir(rootDir)
+	if len(files) != 0 {
+		t.Errorf("Expected nothing to be created, but found %d entries", len(files))
+	}
+}
+
+// TestBuildProjectStructure_FileContent tests that inline and sourced contents are written.
+func TestBuildProjectStructure_FileContent(t *testing.T) {
+	rootDir := setupTestRootDir(t)
+	defer os.RemoveAll(rootDir) // Clean up after the test
+
+	templateDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(templateDir, "Makefile.tmpl"), []byte("build:\n\tgo build ./...\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	lines := []string{
+		"cmd",
+		"-main.go <<EOF",
+		"package main",
+		"",
+		"func main() {}",
+		"EOF",
+		"Makefile < Makefile.tmpl",
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{BaseDir: templateDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		filepath.Join(rootDir, "cmd", "main.go"): "package main\n\nfunc main() {}\n",
+		filepath.Join(rootDir, "Makefile"):       "build:\n\tgo build ./...\n",
+	}
+	for path, want := range expected {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Expected file %s to exist: %v", path, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("Content of %s = %q; want %q", path, got, want)
+		}
+	}
+}
+
+// TestBuildProjectStructure_MissingSource tests that an unreadable source stops the build before it starts.
+func TestBuildProjectStructure_MissingSource(t *testing.T) {
+	rootDir := setupTestRootDir(t)
+	defer os.RemoveAll(rootDir) // Clean up after the test
+
+	lines := []string{
+		"src",
+		"-main.go < does-not-exist.go",
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{BaseDir: t.TempDir()})
+
+	var sourceErr *SourceError
+	if !errors.As(err, &sourceErr) || sourceErr.Line != 2 {
+		t.Fatalf("Expected a source error at line 2, got %v", err)
+	}
+	files, _ := os.ReadDir(rootDir)
+	if len(files) != 0 {
+		t.Errorf("Expected nothing to be created, but found %d entries", len(files))
+	}
+}
+
+// TestBuildProjectStructure_SourceRender tests that content sources are
+// rendered with the template variables, unless they are marked literal.
+func TestBuildProjectStructure_SourceRender(t *testing.T) {
+	baseDir := t.TempDir()
+	templates := map[string]string{
+		"README.tmpl": "# {{.Name}}\n{{if .Owner}}Owned by {{.Owner}}.\n{{end}}",
+		"chart.yaml":  "image: {{ .Values.image }}\n",
+		"broken.tmpl": "# {{.Name}}\n{{.Missing}}\n",
+	}
+	for name, content := range templates {
+		if err := os.WriteFile(filepath.Join(baseDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+	}
+	vars := render.Vars{"Name": "billing", "Owner": "platform"}
+
+	rootDir := filepath.Join(t.TempDir(), "root")
+	lines := []string{"README.md < README.tmpl", "chart.yaml [render=false] < chart.yaml"}
+	if err := BuildProjectStructure(lines, rootDir, Options{BaseDir: baseDir, Vars: vars}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"README.md":  "# billing\nOwned by platform.\n",
+		"chart.yaml": "image: {{ .Values.image }}\n",
+	}
+	for name, want := range expected {
+		if got, _ := os.ReadFile(filepath.Join(rootDir, name)); string(got) != want {
+			t.Errorf("Content of %s = %q; want %q", name, got, want)
+		}
+	}
+
+	rootDir = filepath.Join(t.TempDir(), "root")
+	err := BuildProjectStructure([]string{"src", "-README.md < broken.tmpl"}, rootDir, Options{BaseDir: baseDir, Vars: vars})
+	var sourceErr *SourceError
+	var renderErr *render.Error
+	if !errors.As(err, &sourceErr) || sourceErr.Line != 2 || !errors.As(err, &renderErr) || renderErr.Line != 2 {
+		t.Fatalf("Expected a render error on line 2 of the source referenced on line 2, got %v", err)
+	}
+	if pathExists(rootDir) {
+		t.Errorf("Expected nothing to be created")
+	}
+}
+
+// TestBuildProjectStructure_SourceEscape tests that content sources cannot be
+// read from outside the base directory, by absolute path, ".." or symlink.
+func TestBuildProjectStructure_SourceEscape(t *testing.T) {
+	parent := t.TempDir()
+	baseDir := filepath.Join(parent, "templates")
+	secret := filepath.Join(parent, "secret.txt")
+	if err := os.MkdirAll(filepath.Join(baseDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create base directory: %v", err)
+	}
+	for path, content := range map[string]string{secret: "secret\n", filepath.Join(baseDir, "ok.txt"): "ok\n"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	escapes := []string{
+		"leak.txt < " + secret,
+		"up.txt < ../secret.txt",
+		"up.txt < sub/../../secret.txt",
+		"up.txt < ../templates/../secret.txt",
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(secret, filepath.Join(baseDir, "link.txt")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		if err := os.Symlink(parent, filepath.Join(baseDir, "sub", "up")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		escapes = append(escapes, "link.txt < link.txt", "up.txt < sub/up/secret.txt")
+	}
+
+	for _, line := range escapes {
+		rootDir := filepath.Join(t.TempDir(), "root")
+		err := BuildProjectStructure([]string{"README.md", line}, rootDir, Options{BaseDir: baseDir})
+		var sourceErr *SourceError
+		if !errors.As(err, &sourceErr) || !errors.Is(err, ErrOutsideBase) || sourceErr.Line != 2 {
+			t.Errorf("%q: expected a source error at line 2 wrapping ErrOutsideBase, got %v", line, err)
+		}
+		if pathExists(rootDir) {
+			t.Errorf("%q: expected nothing to be created", line)
+		}
+	}
+
+	// Sources may move around inside the base directory
+	rootDir := filepath.Join(t.TempDir(), "root")
+	if err := BuildProjectStructure([]string{"ok.txt < sub/../ok.txt"}, rootDir, Options{BaseDir: baseDir}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(rootDir, "ok.txt")); string(got) != "ok\n" {
+		t.Errorf("Content of ok.txt = %q; want %q", got, "ok\n")
+	}
+}
+
+// TestBuildProjectStructure_YAML tests that a YAML structure is built with its contents and modes.
+func TestBuildProjectStructure_YAML(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	rootDir := setupTestRootDir(t)
+	defer os.RemoveAll(rootDir) // Clean up after the test
+
+	lines := []string{
+		"cmd:",
+		"  main.go: |",
+		"    package main",
+		"scripts:",
+		"  $mode: \"0700\"",
+		"  run.sh:",
+		"    $content: \"#!/bin/sh\\n\"",
+		"    $mode: \"0755\"",
+		"README.md: null",
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{Format: spec.FormatYAML})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	validateStructure(t,
+		[]string{filepath.Join(rootDir, "cmd"), filepath.Join(rootDir, "scripts")},
+		[]string{filepath.Join(rootDir, "cmd", "main.go"), filepath.Join(rootDir, "scripts", "run.sh"), filepath.Join(rootDir, "README.md")},
+	)
+	content, _ := os.ReadFile(filepath.Join(rootDir, "cmd", "main.go"))
+	if string(content) != "package main\n" {
+		t.Errorf("Content of main.go = %q; want %q", content, "package main\n")
+	}
+	modes := map[string]os.FileMode{
+		filepath.Join(rootDir, "scripts"):           0700,
+		filepath.Join(rootDir, "scripts", "run.sh"): 0755,
+	}
+	for path, want := range modes {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", path, err)
+			continue
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("Mode of %s = %04o; want %04o", path, got, want)
+		}
+	}
+}
+
+// TestBuildProjectStructure_Symlink tests that "name -> target" entries become symlinks.
+func TestBuildProjectStructure_Symlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	rootDir := setupTestRootDir(t)
+	defer os.RemoveAll(rootDir) // Clean up after the test
+
+	lines := []string{
+		"config",
+		"-base.yaml",
+		"-current.yaml -> base.yaml",
+		"bin -> ../tools/bin",
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	links := map[string]string{
+		filepath.Join(rootDir, "config", "current.yaml"): "base.yaml",
+		filepath.Join(rootDir, "bin"):                    "../tools/bin",
+	}
+	for path, want := range links {
+		target, err := os.Readlink(path)
+		if err != nil {
+			t.Errorf("Expected %s to be a symlink: %v", path, err)
+			continue
+		}
+		if target != want {
+			t.Errorf("Target of %s = %q; want %q", path, target, want)
+		}
+	}
+}
+
+// captureOutput returns what f prints to stdout.
+func captureOutput(f func()) string {
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	f()
+	w.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
+// TestBuildProjectStructure_FilledReported tests that an existing empty file
+// filled with its content is reported as updated rather than created.
+func TestBuildProjectStructure_FilledReported(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootDir, "empty.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	lines := []string{"empty.txt <<EOF", "filled", "EOF", "new.txt"}
+	var err error
+	output := captureOutput(func() {
+		err = BuildProjectStructure(lines, rootDir, Options{})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{"Updated file: " + filepath.Join(rootDir, "empty.txt"), "Created file: " + filepath.Join(rootDir, "new.txt")} {
+		if !strings.Contains(output, want+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+// TestBuildProjectStructure_Conflicts tests every conflict policy against the same existing tree.
+func TestBuildProjectStructure_Conflicts(t *testing.T) {
+	lines := []string{
+		"src",
+		"-main.go <<EOF",
+		"package main",
+		"EOF",
+		"-util.go",
+		"empty.txt <<EOF",
+		"filled",
+		"EOF",
+		"docs",
+		"-guide.md",
+	}
+	tests := []struct {
+		policy   ConflictPolicy
+		prompt   func(Conflict) (ConflictPolicy, error)
+		main     string // content of src/main.go afterwards
+		docsDir  bool   // whether docs ends up a directory
+		backups  []string
+		conflict bool // whether a *ConflictError is expected
+	}{
+		{policy: "", main: "keep\n"},
+		{policy: ConflictSkip, main: "keep\n"},
+		{policy: ConflictOverwrite, main: "package main\n", docsDir: true},
+		{policy: ConflictBackup, main: "package main\n", docsDir: true, backups: []string{"src/main.go.bak", "docs.bak"}},
+		{policy: ConflictFail, main: "keep\n", conflict: true},
+		{
+			policy: ConflictPrompt,
+			prompt: func(c Conflict) (ConflictPolicy, error) {
+				if filepath.Base(c.Path) == "main.go" {
+					return ConflictOverwrite, nil
+				}
+				return ConflictSkip, nil
+			},
+			main: "package main\n",
+		},
+	}
+
+	for _, test := range tests {
+		rootDir := t.TempDir()
+		for path, content := range map[string]string{"src/main.go": "keep\n", "empty.txt": "", "docs": "not a directory\n"} {
+			fullPath := filepath.Join(rootDir, path)
+			os.MkdirAll(filepath.Dir(fullPath), 0755)
+			if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+		}
+
+		err := BuildProjectStructure(lines, rootDir, Options{OnConflict: test.policy, Prompt: test.prompt})
+		var conflictErr *ConflictError
+		if test.conflict {
+			if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 2 {
+				t.Errorf("%q: expected a *ConflictError with 2 conflicts, got %v", test.policy, err)
+			}
+			if _, err := os.Stat(filepath.Join(rootDir, "src", "util.go")); !os.IsNotExist(err) {
+				t.Errorf("%q: expected nothing to be created", test.policy)
+			}
+		} else if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.policy, err)
+			continue
+		}
+
+		if content, _ := os.ReadFile(filepath.Join(rootDir, "src", "main.go")); string(content) != test.main {
+			t.Errorf("%q: content of main.go = %q; want %q", test.policy, content, test.main)
+		}
+		if info, err := os.Stat(filepath.Join(rootDir, "docs")); err != nil || info.IsDir() != test.docsDir {
+			t.Errorf("%q: expected docs to be a directory: %v", test.policy, test.docsDir)
+		}
+		if _, err := os.Stat(filepath.Join(rootDir, "docs", "guide.md")); (err == nil) != test.docsDir {
+			t.Errorf("%q: expected docs/guide.md to exist: %v", test.policy, test.docsDir)
+		}
+		for _, backup := range test.backups {
+			if _, err := os.Stat(filepath.Join(rootDir, backup)); err != nil {
+				t.Errorf("%q: expected backup %s: %v", test.policy, backup, err)
+			}
+		}
+		if test.conflict {
+			continue
+		}
+		// Empty files are never a conflict, and new entries are always created
+		if content, _ := os.ReadFile(filepath.Join(rootDir, "empty.txt")); string(content) != "filled\n" {
+			t.Errorf("%q: content of empty.txt = %q; want %q", test.policy, content, "filled\n")
+		}
+		validateStructure(t, []string{filepath.Join(rootDir, "src")}, []string{filepath.Join(rootDir, "src", "util.go")})
+	}
+}
+
+// atomicFailingLines is a structure whose last entry fails, its name being
+// too long, once everything before it has been created.
+var atomicFailingLines = []string{
+	"src",
+	"-main.go <<EOF",
+	"package main",
+	"EOF",
+	"empty.txt <<EOF",
+	"filled",
+	"EOF",
+	"keep.txt <<EOF",
+	"new",
+	"EOF",
+	tooLongName,
+}
+
+// TestBuildProjectStructure_AtomicNewRoot tests that a failed atomic build of
+// a new root leaves nothing behind, not even the parents created for it.
+func TestBuildProjectStructure_AtomicNewRoot(t *testing.T) {
+	failing := atomicFailingLines
+	parent := t.TempDir()
+	rootDir := filepath.Join(parent, "work", "clients", "project")
+
+	err := BuildProjectStructure(failing, rootDir, Options{Atomic: true})
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) || !buildErr.RolledBack {
+		t.Fatalf("Expected a rolled back *BuildError, got %v", err)
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+		t.Errorf("Expected nothing to be left in %s, found %d entries", parent, len(entries))
+	}
+
+	err = BuildProjectStructure(failing[:len(failing)-1], rootDir, Options{Atomic: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	validateStructure(t, []string{rootDir}, []string{filepath.Join(rootDir, "src", "main.go"), filepath.Join(rootDir, "keep.txt")})
+	if entries, _ := os.ReadDir(filepath.Dir(rootDir)); len(entries) != 1 {
+		t.Errorf("Expected only the root to be left next to it, found %d entries", len(entries))
+	}
+}
+
+// TestBuildProjectStructure_AtomicRollbackFails tests that a build whose
+// rollback could not undo everything does not claim to be rolled back.
+func TestBuildProjectStructure_AtomicRollbackFails(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootDir, "config.yaml"), []byte("old: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	lines := []string{
+		"src",
+		"-main.go",
+		"config.yaml <<EOF",
+		"new: true",
+		"EOF",
+	}
+	// Something else writes into src while the build waits for an answer
+	intruder := filepath.Join(rootDir, "src", "intruder.go")
+	prompt := func(Conflict) (ConflictPolicy, error) {
+		if err := os.WriteFile(intruder, nil, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		return "", errors.New("no answer")
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{Atomic: true, OnConflict: ConflictPrompt, Prompt: prompt})
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) || buildErr.RolledBack || len(buildErr.Failures) != 2 {
+		t.Fatalf("Expected a *BuildError with 2 failures, not rolled back, got %v", err)
+	}
+	if strings.Contains(err.Error(), "undone") {
+		t.Errorf("Error claims the changes were undone: %v", err)
+	}
+	validateStructure(t, []string{filepath.Join(rootDir, "src")}, []string{intruder})
+	if _, err := os.Stat(filepath.Join(rootDir, "src", "main.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected src/main.go to be removed")
+	}
+}
+
+// TestBuildProjectStructure_AtomicExistingRoot tests that a failed atomic build in an existing root is undone.
+func TestBuildProjectStructure_AtomicExistingRoot(t *testing.T) {
+	failing := atomicFailingLines
+	rootDir := t.TempDir()
+	existing := map[string]string{"empty.txt": "", "keep.txt": "old\n"}
+	for name, content := range existing {
+		if err := os.WriteFile(filepath.Join(rootDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	for _, policy := range []ConflictPolicy{ConflictOverwrite, ConflictBackup} {
+		err := BuildProjectStructure(failing, rootDir, Options{Atomic: true, OnConflict: policy})
+		var buildErr *BuildError
+		if !errors.As(err, &buildErr) || !buildErr.RolledBack || len(buildErr.Failures) != 1 {
+			t.Fatalf("%s: expected a rolled back *BuildError with 1 failure, got %v", policy, err)
+		}
+		entries, _ := os.ReadDir(rootDir)
+		if len(entries) != len(existing) {
+			t.Errorf("%s: expected %d entries after rollback, found %d", policy, len(existing), len(entries))
+		}
+		for name, want := range existing {
+			if content, _ := os.ReadFile(filepath.Join(rootDir, name)); string(content) != want {
+				t.Errorf("%s: content of %s = %q; want %q", policy, name, content, want)
+			}
+		}
+	}
+
+	err := BuildProjectStructure(failing[:len(failing)-1], rootDir, Options{Atomic: true, OnConflict: ConflictOverwrite})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(rootDir, "keep.txt")); string(content) != "new\n" {
+		t.Errorf("Content of keep.txt = %q; want %q", content, "new\n")
+	}
+	if entries, _ := os.ReadDir(rootDir); len(entries) != 3 {
+		t.Errorf("Expected replaced entries to be removed, found %d entries", len(entries))
+	}
+}
+
+// TestBuildProjectStructure_SymlinkEscape tests that symlinks, existing or
+// created by the structure, cannot carry entries outside the root.
+func TestBuildProjectStructure_SymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	outside := t.TempDir()
+	rootDir := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(rootDir, "existing")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	// A link made by the structure cannot be declared again as a directory
+	// or file to write through
+	lines := []string{
+		"out -> " + outside,
+		"out/",
+		"-evil.sh",
+		"up -> ..",
+		"up/",
+		"-evil.sh",
+		"f -> " + filepath.Join(outside, "target"),
+		"f:file <<EOF",
+		"pwned",
+		"EOF",
+	}
+	err := BuildProjectStructure(lines, rootDir, Options{OnConflict: ConflictOverwrite})
+	var list spec.ErrorList
+	if !errors.As(err, &list) || len(list) != 3 {
+		t.Fatalf("Expected 3 duplicate entry errors, got %v", err)
+	}
+
+	// An existing link is replaced rather than followed
+	err = BuildProjectStructure([]string{"existing/", "-evil.sh", "safe.txt"}, rootDir, Options{OnConflict: ConflictOverwrite})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written outside the root, found %d entries in %s", len(entries), outside)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(rootDir), "evil.sh")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written above the root")
+	}
+	validateStructure(t, []string{filepath.Join(rootDir, "existing")}, []string{filepath.Join(rootDir, "existing", "evil.sh"), filepath.Join(rootDir, "safe.txt")})
+}
+
+// TestBuildProjectStructure_WriteThroughSymlink tests that a file replaced by
+// a symlink during the build is not written through, whether it is new or
+// an empty file being filled.
+func TestBuildProjectStructure_WriteThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	outside := t.TempDir()
+	rootDir := t.TempDir()
+	existing := map[string]string{"config.yaml": "old: true\n", "empty.txt": ""}
+	for name, content := range existing {
+		if err := os.WriteFile(filepath.Join(rootDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	lines := []string{
+		"config.yaml <<EOF",
+		"new: true",
+		"EOF",
+		"empty.txt [mode=0600] <<EOF",
+		"pwned",
+		"EOF",
+		"new.txt [mode=0600] <<EOF",
+		"pwned",
+		"EOF",
+	}
+	// Something else swaps the files for links while the build waits for an answer
+	prompt := func(Conflict) (ConflictPolicy, error) {
+		for _, name := range []string{"empty.txt", "new.txt"} {
+			path := filepath.Join(rootDir, name)
+			os.Remove(path)
+			if err := os.Symlink(filepath.Join(outside, name), path); err != nil {
+				t.Fatalf("Failed to create symlink: %v", err)
+			}
+		}
+		return ConflictSkip, nil
+	}
+
+	err := BuildProjectStructure(lines, rootDir, Options{OnConflict: ConflictPrompt, Prompt: prompt})
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) || len(buildErr.Failures) != 2 {
+		t.Fatalf("Expected a *BuildError with 2 failures, got %v", err)
+	}
+	for _, failure := range buildErr.Failures {
+		if !errors.Is(failure, ErrSymlink) {
+			t.Errorf("Expected a symlink failure, got %v", failure)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written outside the root, found %d entries in %s", len(entries), outside)
+	}
+}
+
+// TestConfiner tests the checks made before each operation.
+func TestConfiner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	parent := t.TempDir()
+	rootDir := filepath.Join(parent, "root")
+	for _, dir := range []string{"root/src", "elsewhere"} {
+		if err := os.MkdirAll(filepath.Join(parent, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	for link, target := range map[string]string{"root/out": "../elsewhere", "root/in": "src", "root-link": "root"} {
+		if err := os.Symlink(target, filepath.Join(parent, link)); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	tests := []struct {
+		root    string
+		path    string
+		allowed bool
+	}{
+		{rootDir, filepath.Join(rootDir, "file"), true},
+		{rootDir, filepath.Join(rootDir, "src", "file"), true},
+		{rootDir, filepath.Join(rootDir, "in", "file"), true},
+		{rootDir, filepath.Join(rootDir, "out"), true}, // replacing the link itself stays inside
+		{rootDir, filepath.Join(rootDir, "out", "file"), false},
+		{rootDir, filepath.Join(rootDir, "..", "file"), false},
+		{rootDir, filepath.Join(parent, "elsewhere", "file"), false},
+		{rootDir, rootDir, false},
+		{rootDir, "/etc/passwd", false},
+		// A root given through a symlink is resolved too
+		{filepath.Join(parent, "root-link"), filepath.Join(parent, "root-link", "src", "file"), true},
+		{filepath.Join(parent, "root-link"), filepath.Join(parent, "root-link", "out", "file"), false},
+	}
+
+	for _, test := range tests {
+		c, err := newConfiner(test.root)
+		if err != nil {
+			t.Fatalf("newConfiner(%q) unexpected error: %v", test.root, err)
+		}
+		err = c.check(test.path)
+		if (err == nil) != test.allowed || (err != nil && !errors.Is(err, ErrOutsideRoot)) {
+			t.Errorf("check(%q) under %q = %v; want allowed %v", test.path, test.root, err, test.allowed)
+		}
+	}
+}
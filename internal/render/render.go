@@ -0,0 +1,154 @@
+// Package render fills {{.Name}}-style placeholders in structure lines before
+// they are parsed, using text/template.
+package render
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// missingKey extracts the variable name from text/template's missingkey error.
+var missingKey = regexp.MustCompile(`map has no entry for key "([^"]*)"`)
+
+// templateLine splits a text/template error into its line number and cause.
+var templateLine = regexp.MustCompile(`^template: structure:(\d+):(?:\d+:)? (.*)$`)
+
+// Vars holds template variables. It implements flag.Value so it can collect
+// repeated --var key=value flags.
+type Vars map[string]string
+
+// String lists the variables as sorted key=value pairs.
+func (v Vars) String() string {
+	pairs := make([]string, 0, len(v))
+	for key, value := range v {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses a single key=value pair.
+func (v Vars) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("invalid variable %q, expected key=value", pair)
+	}
+	v[key] = strings.TrimSpace(value)
+	return nil
+}
+
+// LoadFile reads key=value pairs from path into v, one per line. Blank lines
+// and lines starting with # are ignored. Variables already in v are kept, so
+// values given on the command line win over the file.
+func (v Vars) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fromFile := Vars{}
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fromFile.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for key, value := range fromFile {
+		if _, ok := v[key]; !ok {
+			v[key] = value
+		}
+	}
+	return nil
+}
+
+// Error reports a line that could not be rendered.
+type Error struct {
+	Line int
+	Err  error
+}
+
+// Error formats the error as "line N: cause".
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the cause of the render failure.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Lines renders every line as its own template with vars as data. Using a
+// variable that is not defined is an error.
+func Lines(lines []string, vars Vars) ([]string, error) {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		if !strings.Contains(line, "{{") {
+			rendered[i] = line
+			continue
+		}
+		text, _, err := execute(line, vars)
+		if err != nil {
+			return nil, &Error{Line: i + 1, Err: err}
+		}
+		rendered[i] = text
+	}
+	return rendered, nil
+}
+
+// Text renders text as a single template with vars as data, so actions can
+// span lines. Errors are reported with the line of text they occur on.
+func Text(text string, vars Vars) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	rendered, line, err := execute(text, vars)
+	if err != nil {
+		return "", &Error{Line: line, Err: err}
+	}
+	return rendered, nil
+}
+
+// execute parses and runs text as a template. It returns the line of text an
+// error occurred on, and names undefined variables in the error.
+func execute(text string, vars Vars) (string, int, error) {
+	tmpl, err := template.New("structure").Option("missingkey=error").Parse(text)
+	if err == nil {
+		var b strings.Builder
+		if err = tmpl.Execute(&b, map[string]string(vars)); err == nil {
+			return b.String(), 0, nil
+		}
+	}
+	line := 1
+	if match := templateLine.FindStringSubmatch(err.Error()); match != nil {
+		line, _ = strconv.Atoi(match[1])
+		err = errors.New(match[2])
+	}
+	if match := missingKey.FindStringSubmatch(err.Error()); match != nil {
+		err = fmt.Errorf("undefined variable %q", match[1])
+	}
+	return "", line, err
+}
+
+// Escape protects literal "{{" in s so that rendering s gives it back
+// unchanged.
+func Escape(s string) string {
+	return strings.ReplaceAll(s, "{{", `{{"{{"}}`)
+}
@@ -0,0 +1,126 @@
+package render
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLines tests that placeholders in names and contents are filled in.
+func TestLines(t *testing.T) {
+	lines := []string{
+		"{{.Name}}",
+		"-cmd",
+		"--{{.Name}}.go <<EOF",
+		"package main // {{.Name}} v{{.Version}}",
+		"EOF",
+		"-README.md",
+	}
+	vars := Vars{"Name": "billing", "Version": "1"}
+
+	rendered, err := Lines(lines, vars)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"billing",
+		"-cmd",
+		"--billing.go <<EOF",
+		"package main // billing v1",
+		"EOF",
+		"-README.md",
+	}
+	for i := range expected {
+		if rendered[i] != expected[i] {
+			t.Errorf("Line %d = %q; want %q", i+1, rendered[i], expected[i])
+		}
+	}
+}
+
+// TestLines_UndefinedVariable tests that an undefined variable is reported with its line.
+func TestLines_UndefinedVariable(t *testing.T) {
+	lines := []string{
+		"{{.Name}}",
+		"-{{.Missing}}.go",
+	}
+
+	_, err := Lines(lines, Vars{"Name": "billing"})
+
+	var renderErr *Error
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("Expected a *render.Error, got %v", err)
+	}
+	if renderErr.Line != 2 || renderErr.Err.Error() != `undefined variable "Missing"` {
+		t.Errorf("Unexpected error: %v", renderErr)
+	}
+}
+
+// TestText tests rendering a whole file, with actions that span lines and
+// errors reported on the line they occur on.
+func TestText(t *testing.T) {
+	text := "# {{.Name}}\n{{if .Owner}}\nOwned by {{.Owner}}.\n{{end}}\n"
+	rendered, err := Text(text, Vars{"Name": "billing", "Owner": "platform"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "# billing\n\nOwned by platform.\n\n"; rendered != expected {
+		t.Errorf("Text() = %q; want %q", rendered, expected)
+	}
+
+	tests := []struct {
+		text string
+		line int
+		msg  string
+	}{
+		{"# {{.Name}}\n\n{{.Missing}}\n", 3, `undefined variable "Missing"`},
+		{"# {{.Name}}\n{{.Name | upper}}\n", 2, `function "upper" not defined`},
+	}
+	for _, test := range tests {
+		_, err := Text(test.text, Vars{"Name": "billing"})
+		var renderErr *Error
+		if !errors.As(err, &renderErr) || renderErr.Line != test.line || !strings.Contains(renderErr.Err.Error(), test.msg) {
+			t.Errorf("Text(%q) error = %v; want line %d: %s", test.text, err, test.line, test.msg)
+		}
+	}
+}
+
+// TestVars tests parsing variables from flags and from a file.
+func TestVars(t *testing.T) {
+	vars := Vars{}
+	if err := vars.Set("Name=billing"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := vars.Set("novalue"); err == nil {
+		t.Errorf("Expected an error for a pair without '='")
+	}
+
+	path := filepath.Join(t.TempDir(), "vars.env")
+	content := "# service settings\nName=ignored\nPort=8080\n\nOwner = platform\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write vars file: %v", err)
+	}
+	if err := vars.LoadFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := Vars{"Name": "billing", "Port": "8080", "Owner": "platform"}
+	if vars.String() != expected.String() {
+		t.Errorf("Vars = %s; want %s", vars, expected)
+	}
+}
+
+// TestEscape tests that escaped text renders back to itself.
+func TestEscape(t *testing.T) {
+	line := "run: echo ${{ secrets.TOKEN }} {{.Name}}"
+
+	rendered, err := Lines([]string{Escape(line)}, Vars{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rendered[0] != line {
+		t.Errorf("Rendered escaped line = %q; want %q", rendered[0], line)
+	}
+}
@@ -0,0 +1,139 @@
+package rules
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/text"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// Violation is a rule that a directory breaks. Scope is the directory the
+// rule was applied to, relative to the root, "." for the root itself. Path
+// is the offending entry, relative to the root, when there is one: a
+// forbidden entry, or one too many.
+type Violation struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Scope       string `json:"scope"`
+	Glob        string `json:"glob"`
+	Path        string `json:"path,omitempty"`
+	Message     string `json:"message"`
+}
+
+// String formats the violation as "rule: scope: message".
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s: %s", v.Rule, v.Scope, v.Message)
+}
+
+// entry is a scanned entry, its path relative to the root.
+type entry struct {
+	path string
+	kind string
+}
+
+// Check scans rootDir with opts and returns the violations of rules, ordered
+// by rule, then scope, then glob.
+func Check(rules []*Rule, rootDir string, opts tree.ScanOptions) ([]Violation, error) {
+	root, err := tree.Scan(rootDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	var entries []entry
+	var collect func(children []*tree.Entry, parent string)
+	collect = func(children []*tree.Entry, parent string) {
+		for _, child := range children {
+			rel := path.Join(parent, child.Name)
+			entries = append(entries, entry{path: rel, kind: spec.ModeKind(child.Mode)})
+			collect(child.Children, rel)
+		}
+	}
+	collect(root.Children, "")
+
+	var violations []Violation
+	for _, rule := range rules {
+		for _, scope := range rule.scopes(entries) {
+			violations = append(violations, rule.check(scope, entries)...)
+		}
+	}
+	return violations, nil
+}
+
+// scopes returns the directories rule applies to, in walk order.
+func (r *Rule) scopes(entries []entry) []string {
+	if r.In == "" {
+		return []string{"."}
+	}
+	var scopes []string
+	for _, e := range entries {
+		if e.kind == "dir" && r.in.Match(e.path, true) {
+			scopes = append(scopes, e.path)
+		}
+	}
+	return scopes
+}
+
+// check counts the entries below scope that match each glob of the rule.
+func (r *Rule) check(scope string, entries []entry) []Violation {
+	prefix := ""
+	if scope != "." {
+		prefix = scope + "/"
+	}
+	var violations []Violation
+	for _, g := range r.globs {
+		var matches []string
+		for _, e := range entries {
+			rel, ok := strings.CutPrefix(e.path, prefix)
+			if !ok || r.Kind != "" && e.kind != r.Kind || r.excepted(rel, e.kind) {
+				continue
+			}
+			if g.pattern.Match(rel, e.kind == "dir") {
+				matches = append(matches, e.path)
+			}
+		}
+		sort.Strings(matches)
+		violation := Violation{Rule: r.ID, Description: r.Description, Scope: scope, Glob: g.text}
+		switch {
+		case r.max == 0:
+			for _, match := range matches {
+				violation.Path = match
+				violation.Message = fmt.Sprintf("%s is forbidden by %q", match, g.text)
+				violations = append(violations, violation)
+			}
+		case len(matches) < r.min:
+			violation.Message = fmt.Sprintf("found %s matching %q, want %s", text.Plural(len(matches), "entry", "entries"), g.text, r.cardinality())
+			violations = append(violations, violation)
+		case r.max > 0 && len(matches) > r.max:
+			violation.Path = matches[r.max]
+			violation.Message = fmt.Sprintf("found %s matching %q, want %s", text.Plural(len(matches), "entry", "entries"), g.text, r.cardinality())
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// excepted reports whether rel, relative to a scope, matches an except glob.
+func (r *Rule) excepted(rel, kind string) bool {
+	for _, pattern := range r.except {
+		if pattern.Match(rel, kind == "dir") {
+			return true
+		}
+	}
+	return false
+}
+
+// cardinality describes how many entries a glob of the rule may match.
+func (r *Rule) cardinality() string {
+	switch {
+	case r.max < 0:
+		return fmt.Sprintf("at least %d", r.min)
+	case r.min == r.max:
+		return fmt.Sprintf("exactly %d", r.min)
+	case r.min == 0:
+		return fmt.Sprintf("at most %d", r.max)
+	}
+	return fmt.Sprintf("between %d and %d", r.min, r.max)
+}
@@ -0,0 +1,48 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/text"
+)
+
+// Report is the JSON document written by WriteJSON.
+type Report struct {
+	Root       string      `json:"root"`
+	Passed     bool        `json:"passed"`
+	Rules      int         `json:"rules"`
+	Violations []Violation `json:"violations"`
+}
+
+// WriteText writes one line per violation to w, then a summary line.
+func WriteText(w io.Writer, rules []*Rule, violations []Violation) error {
+	var b strings.Builder
+	broken := map[string]bool{}
+	for _, violation := range violations {
+		broken[violation.Rule] = true
+		b.WriteString(violation.String())
+		b.WriteString("\n")
+	}
+	if len(violations) == 0 {
+		fmt.Fprintf(&b, "All %d rules passed\n", len(rules))
+	} else {
+		fmt.Fprintf(&b, "%s, %d of %d rules failed\n", text.Plural(len(violations), "violation", "violations"), len(broken), len(rules))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the result of checking rootDir against rules to w as an
+// indented Report.
+func WriteJSON(w io.Writer, rootDir string, rules []*Rule, violations []Violation) error {
+	report := Report{Root: rootDir, Passed: len(violations) == 0, Rules: len(rules), Violations: violations}
+	if report.Violations == nil {
+		report.Violations = []Violation{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,235 @@
+// Package rules reads layout rule files and checks directories against them.
+//
+// A rule file is a YAML or JSON document with a list of rules:
+//
+//	rules:
+//	  - id: service-layout
+//	    description: Every service has cmd/, internal/ and a README.md
+//	    in: services/*/
+//	    require: [cmd/, internal/, README.md]
+//	  - id: root-files
+//	    description: No files at the root other than the README and Go modules
+//	    forbid: ["*"]
+//	    kind: file
+//	    except: [README.md, go.mod, go.sum]
+//	  - id: one-license
+//	    optional: ["LICENSE*"]
+//	    max: 1
+//
+// Globs follow .gitignore syntax, relative to the directory a rule applies
+// to: "*" does not cross a slash, "**" does, and a trailing slash only
+// matches directories.
+package rules
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jobehi/mkproj/internal/ignore"
+	"github.com/jobehi/mkproj/internal/spec"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is one check of a rule file. Exactly one of Require, Forbid and
+// Optional is set, and its globs are counted separately against the entries
+// below each directory the rule applies to: every directory matching In, or
+// the root when In is empty. Entries matching Except, or not of Kind when it
+// is set, are never counted.
+//
+// Require globs must match at least Min entries, 1 by default, and at most
+// Max when it is set. Forbid globs must match nothing. Optional globs may
+// match nothing, but no more than Max entries.
+type Rule struct {
+	ID          string   `yaml:"id"`
+	Description string   `yaml:"description"`
+	In          string   `yaml:"in"`
+	Require     []string `yaml:"require"`
+	Forbid      []string `yaml:"forbid"`
+	Optional    []string `yaml:"optional"`
+	Except      []string `yaml:"except"`
+	Kind        string   `yaml:"kind"`
+	Min         *int     `yaml:"min"`
+	Max         *int     `yaml:"max"`
+
+	in       ignore.Pattern
+	globs    []glob
+	except   []ignore.Pattern
+	min, max int // max is -1 when unbounded
+}
+
+// glob is a compiled Require, Forbid or Optional glob.
+type glob struct {
+	text    string
+	pattern ignore.Pattern
+}
+
+// ruleKeys are the keys a rule mapping may have.
+var ruleKeys = map[string]bool{
+	"id": true, "description": true, "in": true, "require": true, "forbid": true,
+	"optional": true, "except": true, "kind": true, "min": true, "max": true,
+}
+
+// Load reads the rule file at path.
+func Load(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Parse reads a rule file. Every problem is reported, with its position, in
+// a spec.ErrorList.
+func Parse(data []byte) ([]*Rule, error) {
+	root, err := spec.DecodeYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, spec.ErrorList{{Line: 1, Column: 1, Msg: "empty rule file"}}
+	}
+	var list *yaml.Node
+	if root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if key := root.Content[i]; key.Value == "rules" {
+				list = root.Content[i+1]
+			} else {
+				return nil, spec.ErrorList{nodeError(key, fmt.Sprintf("unknown key %q, expected rules", key.Value))}
+			}
+		}
+	}
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return nil, spec.ErrorList{nodeError(root, "the document must have a rules list")}
+	}
+
+	var errs spec.ErrorList
+	var rules []*Rule
+	seen := map[string]bool{}
+	for _, item := range list.Content {
+		rule, err := parseRule(item)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[rule.ID] {
+			errs = append(errs, nodeError(item, fmt.Sprintf("duplicate rule id %q", rule.ID)))
+			continue
+		}
+		seen[rule.ID] = true
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return rules, nil
+}
+
+// parseRule decodes and validates one rule, compiling its globs.
+func parseRule(node *yaml.Node) (*Rule, *spec.ParseError) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nodeError(node, "a rule must be a mapping")
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if key := node.Content[i]; !ruleKeys[key.Value] {
+			return nil, nodeError(key, fmt.Sprintf("unknown rule key %q", key.Value))
+		}
+	}
+	rule := &Rule{}
+	if err := node.Decode(rule); err != nil {
+		return nil, nodeError(node, strings.TrimPrefix(err.Error(), "yaml: unmarshal errors:\n  "))
+	}
+	fail := func(format string, args ...any) (*Rule, *spec.ParseError) {
+		msg := fmt.Sprintf(format, args...)
+		if rule.ID != "" {
+			msg = fmt.Sprintf("rule %q: %s", rule.ID, msg)
+		}
+		return nil, nodeError(node, msg)
+	}
+
+	if rule.ID == "" {
+		return fail("missing id")
+	}
+	var globs []string
+	kinds := 0
+	for _, list := range [][]string{rule.Require, rule.Forbid, rule.Optional} {
+		if len(list) > 0 {
+			globs = list
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fail("needs exactly one of require, forbid and optional")
+	}
+	switch rule.Kind {
+	case "", "dir", "file", "symlink":
+	default:
+		return fail("unknown kind %q, expected dir, file or symlink", rule.Kind)
+	}
+
+	rule.min, rule.max = 0, -1
+	switch {
+	case len(rule.Require) > 0:
+		rule.min = 1
+	case len(rule.Forbid) > 0:
+		if rule.Min != nil || rule.Max != nil {
+			return fail("forbid rules cannot have min or max")
+		}
+		rule.max = 0
+	case rule.Min != nil:
+		return fail("optional rules cannot have min, use require")
+	case rule.Max == nil:
+		return fail("optional rules need a max")
+	}
+	if rule.Min != nil {
+		rule.min = *rule.Min
+	}
+	if rule.Max != nil {
+		rule.max = *rule.Max
+	}
+	if rule.Min != nil && *rule.Min < 0 || rule.Max != nil && *rule.Max < 0 {
+		return fail("min and max cannot be negative")
+	}
+	if rule.max >= 0 && rule.min > rule.max {
+		return fail("min %d is greater than max %d", rule.min, rule.max)
+	}
+
+	var ok bool
+	if rule.In != "" {
+		if rule.in, ok = compile(rule.In); !ok {
+			return fail("invalid in glob %q", rule.In)
+		}
+	}
+	for _, text := range globs {
+		pattern, ok := compile(text)
+		if !ok {
+			return fail("invalid glob %q", text)
+		}
+		rule.globs = append(rule.globs, glob{text: text, pattern: pattern})
+	}
+	for _, text := range rule.Except {
+		pattern, ok := compile(text)
+		if !ok {
+			return fail("invalid except glob %q", text)
+		}
+		rule.except = append(rule.except, pattern)
+	}
+	return rule, nil
+}
+
+// compile parses a glob anchored at the directory a rule applies to.
+// Negations have no meaning in a rule and are refused.
+func compile(text string) (ignore.Pattern, bool) {
+	if strings.HasPrefix(text, "!") || strings.HasPrefix(text, "#") {
+		return ignore.Pattern{}, false
+	}
+	return ignore.ParsePattern("/" + strings.TrimPrefix(text, "/"))
+}
+
+func nodeError(node *yaml.Node, msg string) *spec.ParseError {
+	return &spec.ParseError{Line: node.Line, Column: node.Column, Msg: msg}
+}
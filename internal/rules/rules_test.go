@@ -0,0 +1,176 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/testfs"
+	"github.com/jobehi/mkproj/internal/tree"
+)
+
+// testRules covers required, forbidden and optional globs with and without
+// cardinality.
+const testRules = `rules:
+  - id: service-layout
+    description: Every service has cmd/, internal/ and a README.md
+    in: services/*/
+    require: [cmd/, internal/, README.md]
+  - id: root-files
+    forbid: ["*"]
+    kind: file
+    except: [README.md, go.mod, "*.sum"]
+  - id: one-license
+    optional: ["LICENSE*"]
+    max: 1
+  - id: docs
+    require: ["docs/**/*.md"]
+    min: 2
+    max: 3
+  - id: no-env
+    forbid: ["**/.env"]
+`
+
+// TestCheck tests the violations reported for each kind of rule.
+func TestCheck(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	rootDir := testfs.Tree(t,
+		"README.md",
+		"go.mod",
+		"go.sum",
+		"notes.txt",
+		"LICENSE",
+		"LICENSE.md",
+		"docs/guide/intro.md",
+		"services/billing/cmd/",
+		"services/billing/internal/",
+		"services/billing/README.md",
+		"services/billing/.env",
+		"services/search/cmd/",
+		"tools/",
+	)
+
+	violations, err := Check(rules, rootDir, tree.ScanOptions{ShowHidden: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Violation{
+		{Rule: "service-layout", Scope: "services/search", Glob: "internal/", Message: `found 0 entries matching "internal/", want at least 1`},
+		{Rule: "service-layout", Scope: "services/search", Glob: "README.md", Message: `found 0 entries matching "README.md", want at least 1`},
+		{Rule: "root-files", Scope: ".", Glob: "*", Path: "LICENSE", Message: `LICENSE is forbidden by "*"`},
+		{Rule: "root-files", Scope: ".", Glob: "*", Path: "LICENSE.md", Message: `LICENSE.md is forbidden by "*"`},
+		{Rule: "root-files", Scope: ".", Glob: "*", Path: "notes.txt", Message: `notes.txt is forbidden by "*"`},
+		{Rule: "one-license", Scope: ".", Glob: "LICENSE*", Path: "LICENSE.md", Message: `found 2 entries matching "LICENSE*", want at most 1`},
+		{Rule: "docs", Scope: ".", Glob: "docs/**/*.md", Message: `found 1 entry matching "docs/**/*.md", want between 2 and 3`},
+		{Rule: "no-env", Scope: ".", Glob: "**/.env", Path: "services/billing/.env", Message: `services/billing/.env is forbidden by "**/.env"`},
+	}
+	expected[0].Description = "Every service has cmd/, internal/ and a README.md"
+	expected[1].Description = expected[0].Description
+	if len(violations) != len(expected) {
+		t.Fatalf("Check() = %v; want %v", violations, expected)
+	}
+	for i := range violations {
+		if violations[i] != expected[i] {
+			t.Errorf("Check()[%d] = %+v; want %+v", i, violations[i], expected[i])
+		}
+	}
+}
+
+// TestParse_Errors tests that invalid rule files are reported at the
+// position of the problem.
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		document string
+		line     int
+		message  string
+	}{
+		{"", 1, "empty rule file"},
+		{"- id: a", 1, "the document must have a rules list"},
+		{"rule:\n  - id: a", 1, `unknown key "rule", expected rules`},
+		{"rules:\n  - require: [a]", 2, "missing id"},
+		{"rules:\n  - id: a\n    requires: [a]", 3, `unknown rule key "requires"`},
+		{"rules:\n  - id: a", 2, `rule "a": needs exactly one of require, forbid and optional`},
+		{"rules:\n  - id: a\n    require: [a]\n    forbid: [b]", 2, "needs exactly one"},
+		{"rules:\n  - id: a\n    forbid: [a]\n    max: 1", 2, "forbid rules cannot have min or max"},
+		{"rules:\n  - id: a\n    optional: [a]", 2, "optional rules need a max"},
+		{"rules:\n  - id: a\n    optional: [a]\n    min: 1\n    max: 2", 2, "optional rules cannot have min"},
+		{"rules:\n  - id: a\n    require: [a]\n    min: 3\n    max: 2", 2, "min 3 is greater than max 2"},
+		{"rules:\n  - id: a\n    require: [a]\n    max: -1", 2, "cannot be negative"},
+		{"rules:\n  - id: a\n    require: [a]\n    kind: socket", 2, `unknown kind "socket"`},
+		{"rules:\n  - id: a\n    require: [\"!a\"]", 2, `invalid glob "!a"`},
+		{"rules:\n  - id: a\n    require: [a]\n  - id: a\n    require: [b]", 4, `duplicate rule id "a"`},
+		{"rules:\n  - id: a\n    require: [a]\n    min: many", 2, "cannot unmarshal"},
+		{"rules: [", 1, "did not find expected node content"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse([]byte(test.document))
+		var errs spec.ErrorList
+		if !errors.As(err, &errs) || errs[0].Line != test.line || !strings.Contains(errs[0].Msg, test.message) {
+			t.Errorf("Parse(%q) = %v; want an error on line %d containing %q", test.document, err, test.line, test.message)
+		}
+	}
+}
+
+// TestWriteText tests the human readable report.
+func TestWriteText(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	violations := []Violation{
+		{Rule: "root-files", Scope: ".", Glob: "*", Path: "notes.txt", Message: `notes.txt is forbidden by "*"`},
+		{Rule: "root-files", Scope: ".", Glob: "*", Path: "TODO", Message: `TODO is forbidden by "*"`},
+	}
+	tests := []struct {
+		violations []Violation
+		expected   string
+	}{
+		{nil, "All 5 rules passed\n"},
+		{violations, "" +
+			"root-files: .: notes.txt is forbidden by \"*\"\n" +
+			"root-files: .: TODO is forbidden by \"*\"\n" +
+			"2 violations, 1 of 5 rules failed\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := WriteText(&out, rules, test.violations); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if out.String() != test.expected {
+			t.Errorf("WriteText(%v) = %q; want %q", test.violations, out.String(), test.expected)
+		}
+	}
+}
+
+// TestWriteJSON tests that the JSON report decodes back, with an empty list
+// rather than null when every rule passes.
+func TestWriteJSON(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	for _, violations := range [][]Violation{nil, {{Rule: "no-env", Scope: ".", Glob: "**/.env", Path: ".env", Message: "forbidden"}}} {
+		var out bytes.Buffer
+		if err := WriteJSON(&out, "repo", rules, violations); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), `"violations": [`) {
+			t.Errorf("WriteJSON(%v) = %s; want a violations list", violations, out.String())
+		}
+		var report Report
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatalf("WriteJSON(%v) wrote invalid JSON: %v", violations, err)
+		}
+		if report.Root != "repo" || report.Passed != (len(violations) == 0) || report.Rules != 5 || len(report.Violations) != len(violations) {
+			t.Errorf("WriteJSON(%v) = %+v", violations, report)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package spec
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attribute keys. mode sets permission bits and render=false keeps a content
+// source from being rendered; size and mtime describe an existing entry, as
+// `mkproj tree` writes them, and have no effect.
+const (
+	modeAttribute   = "mode"
+	renderAttribute = "render"
+	sizeAttribute   = "size"
+	mtimeAttribute  = "mtime"
+)
+
+// cutAttributes removes an attribute block such as " [mode=0755]" from the
+// end of chars. The block must follow a blank and end the name with an
+// unescaped "]", so names like "[id]" or "draft [1\]" are left alone. It
+// returns the text between the brackets and the index of the "[".
+func cutAttributes(chars []char) ([]char, string, int, bool) {
+	last := len(chars) - 1
+	if last < 0 || chars[last].r != ']' || chars[last].escaped {
+		return chars, "", 0, false
+	}
+	for i := last - 1; i > 0; i-- {
+		if chars[i].r != '[' || chars[i].escaped {
+			continue
+		}
+		if !isBlank(chars[i-1]) {
+			return chars, "", 0, false
+		}
+		return trimChars(chars[:i]), charsString(chars[i+1 : last]), i, true
+	}
+	return chars, "", 0, false
+}
+
+// parseAttributes reads the "key=value" pairs of an attribute block,
+// separated by commas or blanks, into entry.
+func parseAttributes(text string, entry *Entry) error {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return fmt.Errorf("empty attribute list")
+	}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return fmt.Errorf("attribute %q has no value, expected %s=<value>", field, key)
+		}
+		switch key {
+		case modeAttribute:
+			mode, err := ParseMode(value)
+			if err != nil {
+				return err
+			}
+			entry.Mode = mode
+		case renderAttribute:
+			literal, err := parseLiteral(value, entry.Source)
+			if err != nil {
+				return err
+			}
+			entry.Literal = literal
+		case sizeAttribute:
+			if err := checkSize(value); err != nil {
+				return err
+			}
+		case mtimeAttribute:
+			if err := checkModTime(value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown attribute %q, expected %s, %s, %s or %s", key, modeAttribute, renderAttribute, sizeAttribute, mtimeAttribute)
+		}
+	}
+	return nil
+}
+
+// checkSize checks the value of a size attribute, which is otherwise
+// ignored.
+func checkSize(value string) error {
+	if size, err := strconv.ParseInt(value, 10, 64); err != nil || size < 0 {
+		return fmt.Errorf("invalid size %q, expected a number of bytes", value)
+	}
+	return nil
+}
+
+// checkModTime checks the value of an mtime attribute, which is otherwise
+// ignored.
+func checkModTime(value string) error {
+	if _, err := time.Parse(time.RFC3339, value); err != nil {
+		return fmt.Errorf("invalid modification time %q, expected a time like 2006-01-02T15:04:05Z", value)
+	}
+	return nil
+}
+
+// parseLiteral reads the value of a render attribute, which only applies to
+// files loaded from a source, and reports whether it turns rendering off.
+func parseLiteral(value, source string) (bool, error) {
+	render, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid render value %q, expected true or false", value)
+	}
+	if source == "" {
+		return false, fmt.Errorf("%s only applies to content loaded from a source", renderAttribute)
+	}
+	return !render, nil
+}
+
+// Attributes are the values written in an attribute block. A zero Mode, a
+// negative Size and a zero ModTime are left out.
+type Attributes struct {
+	Mode    fs.FileMode
+	Size    int64
+	ModTime time.Time
+}
+
+// Format renders a as an attribute block to append to a line written by
+// FormatLine, or "" when there is nothing to write.
+func (a Attributes) Format() string {
+	var fields []string
+	if a.Mode != 0 {
+		fields = append(fields, fmt.Sprintf("%s=%04o", modeAttribute, uint32(a.Mode.Perm())))
+	}
+	if a.Size >= 0 {
+		fields = append(fields, fmt.Sprintf("%s=%d", sizeAttribute, a.Size))
+	}
+	if !a.ModTime.IsZero() {
+		fields = append(fields, mtimeAttribute+"="+a.ModTime.Format(time.RFC3339))
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(fields, " ") + "]"
+}
+
+// FormatMode renders mode as an attribute block to append to a line written
+// by FormatLine, or "" for a zero mode.
+func FormatMode(mode fs.FileMode) string {
+	return Attributes{Mode: mode, Size: -1}.Format()
+}
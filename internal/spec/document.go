@@ -0,0 +1,358 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Attribute keys of a mapping in the YAML and JSON formats. A mapping with
+// a content or source key is a file, one with a link key a symlink, and one
+// with nothing but mode, size and mtime keys a file too, unless its name
+// ends in "/". Any other mapping is a directory. Size and mtime are written
+// by `mkproj tree` and ignored.
+const (
+	contentKey = "$content"
+	sourceKey  = "$source"
+	modeKey    = "$mode"
+	linkKey    = "$link"
+	renderKey  = "$render"
+	sizeKey    = "$size"
+	mtimeKey   = "$mtime"
+)
+
+// parseDocument reads the YAML and JSON formats, where a document is a
+// mapping of names to entries:
+//
+//	src:
+//	  main.go: |
+//	    package main
+//	  scripts:
+//	    run.sh:
+//	      $content: "#!/bin/sh\n"
+//	      $mode: "0755"
+//	  empty: {}
+//	  latest:
+//	    $link: run.sh
+//	README.md: null
+//
+// A nested mapping is a directory and a string is the content of a file; null
+// is an empty file. A name ending in "/" is always a directory. Entries keep
+// the order they are written in.
+func parseDocument(lines []string, format Format) ([]*Node, error) {
+	data := []byte(strings.Join(lines, "\n"))
+	var root *yaml.Node
+	var err error
+	if format == FormatJSON {
+		root, err = decodeJSON(data)
+	} else {
+		root, err = DecodeYAML(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, ErrorList{nodeError(root, "the document must be a mapping of names to entries")}
+	}
+	var errs ErrorList
+	nodes := documentEntries(root, 0, &errs)
+	if len(errs) > 0 {
+		return nodes, errs
+	}
+	return nodes, nil
+}
+
+// documentEntries converts the name to entry pairs of mapping into nodes at
+// depth, skipping attribute keys.
+func documentEntries(mapping *yaml.Node, depth int, errs *ErrorList) []*Node {
+	var nodes []*Node
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], resolveAlias(mapping.Content[i+1])
+		name := key.Value
+		if strings.HasPrefix(name, "$") {
+			if depth == 0 {
+				*errs = append(*errs, nodeError(key, fmt.Sprintf("attribute %q must belong to an entry", name)))
+			}
+			continue
+		}
+		if key.Kind != yaml.ScalarNode {
+			*errs = append(*errs, nodeError(key, fmt.Sprintf("invalid entry name %q", name)))
+			continue
+		}
+		dir := strings.HasSuffix(name, dirSlash)
+		name = strings.TrimSuffix(name, dirSlash)
+		if err := ValidateName(name); err != nil {
+			*errs = append(*errs, nodeError(key, err.Error()))
+			continue
+		}
+		if seen[name] {
+			*errs = append(*errs, nodeError(key, fmt.Sprintf("duplicate entry %q", name)))
+			continue
+		}
+		seen[name] = true
+		node := &Node{Name: name, Kind: File, Depth: depth, Line: key.Line, Column: key.Column, explicit: true}
+		switch value.Kind {
+		case yaml.ScalarNode:
+			if value.Tag != "!!null" {
+				node.Content = value.Value
+			}
+			if dir && node.Content != "" {
+				*errs = append(*errs, nodeError(value, fmt.Sprintf("directory %q cannot have content", name)))
+				continue
+			}
+			if dir {
+				node.Kind = Dir
+			}
+		case yaml.MappingNode:
+			documentAttributes(node, value, dir, errs)
+			if node.Kind == Dir {
+				node.Children = documentEntries(value, depth+1, errs)
+			}
+		default:
+			*errs = append(*errs, nodeError(value, fmt.Sprintf("entry %q must be a string, null or a mapping", name)))
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// documentAttributes applies the attribute keys of mapping to node, and
+// works out its kind. dir is set when its name is marked as a directory.
+func documentAttributes(node *Node, mapping *yaml.Node, dir bool, errs *ErrorList) {
+	node.Kind = Dir
+	var render *yaml.Node
+	metadataOnly := true
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], resolveAlias(mapping.Content[i+1])
+		if !strings.HasPrefix(key.Value, "$") {
+			metadataOnly = false
+			continue
+		}
+		if value.Kind != yaml.ScalarNode {
+			*errs = append(*errs, nodeError(value, fmt.Sprintf("%s must be a string", key.Value)))
+			continue
+		}
+		switch key.Value {
+		case contentKey:
+			node.Kind = File
+			node.Content = value.Value
+		case sourceKey:
+			node.Kind = File
+			node.Source = value.Value
+		case linkKey:
+			if !CanFormatTarget(value.Value) {
+				*errs = append(*errs, nodeError(value, fmt.Sprintf("invalid symlink target %q", value.Value)))
+				continue
+			}
+			node.Kind = Symlink
+			node.Target = value.Value
+		case modeKey:
+			mode, err := ParseMode(value.Value)
+			if err != nil {
+				*errs = append(*errs, nodeError(value, err.Error()))
+				continue
+			}
+			node.Mode = mode
+		case renderKey:
+			render = value
+		case sizeKey:
+			if err := checkSize(value.Value); err != nil {
+				*errs = append(*errs, nodeError(value, err.Error()))
+			}
+		case mtimeKey:
+			if err := checkModTime(value.Value); err != nil {
+				*errs = append(*errs, nodeError(value, err.Error()))
+			}
+		default:
+			*errs = append(*errs, nodeError(key, fmt.Sprintf("unknown attribute %q, expected %s, %s, %s, %s, %s, %s or %s", key.Value, contentKey, sourceKey, linkKey, modeKey, renderKey, sizeKey, mtimeKey)))
+		}
+		if key.Value != modeKey && key.Value != sizeKey && key.Value != mtimeKey {
+			metadataOnly = false
+		}
+	}
+	if dir && node.Kind != Dir {
+		*errs = append(*errs, nodeError(mapping, fmt.Sprintf("directory %q cannot have %s, %s or %s", node.Name, contentKey, sourceKey, linkKey)))
+		return
+	}
+	if metadataOnly && len(mapping.Content) > 0 && !dir {
+		// What `mkproj tree` writes for a file with metadata
+		node.Kind = File
+	}
+	if render != nil {
+		literal, err := parseLiteral(render.Value, node.Source)
+		if err != nil {
+			*errs = append(*errs, nodeError(render, err.Error()))
+		}
+		node.Literal = literal
+	}
+	if node.Content != "" && node.Source != "" {
+		*errs = append(*errs, nodeError(mapping, fmt.Sprintf("entry %q has both %s and %s", node.Name, contentKey, sourceKey)))
+		return
+	}
+	if node.Target != "" && (node.Content != "" || node.Source != "") {
+		*errs = append(*errs, nodeError(mapping, fmt.Sprintf("symlink %q cannot have %s or %s", node.Name, contentKey, sourceKey)))
+		return
+	}
+	if node.Kind != Dir {
+		for i := 0; i < len(mapping.Content); i += 2 {
+			if key := mapping.Content[i]; !strings.HasPrefix(key.Value, "$") {
+				*errs = append(*errs, nodeError(key, fmt.Sprintf("%s %q cannot contain other entries", node.Kind, node.Name)))
+				return
+			}
+		}
+	}
+}
+
+// ParseMode reads permission bits written in octal, such as "0755" or "644".
+func ParseMode(s string) (fs.FileMode, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0o"), "0O")
+	mode, err := strconv.ParseUint(digits, 8, 32)
+	if err != nil || mode > 0o777 || digits == "" {
+		return 0, fmt.Errorf("invalid mode %q, expected octal permission bits such as 0644", s)
+	}
+	return fs.FileMode(mode), nil
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+func nodeError(node *yaml.Node, msg string) *ParseError {
+	return &ParseError{Line: node.Line, Column: node.Column, Msg: msg}
+}
+
+// yamlErrorLine matches the position yaml.v3 puts in its error messages.
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// DecodeYAML parses data into its root node, or nil for an empty document.
+// Syntax errors are returned as an ErrorList with the line yaml.v3 reports.
+func DecodeYAML(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			return nil, ErrorList{{Line: line, Column: 1, Msg: match[2]}}
+		}
+		return nil, ErrorList{{Line: 1, Column: 1, Msg: strings.TrimPrefix(err.Error(), "yaml: ")}}
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+// decodeJSON parses data into the same node tree DecodeYAML produces, so both
+// formats share one reader. JSON is decoded on its own rather than as YAML,
+// which rejects some valid JSON such as tab indentation and "\/" escapes.
+func decodeJSON(data []byte) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	d := &jsonDecoder{dec: json.NewDecoder(bytes.NewReader(data)), data: data}
+	d.dec.UseNumber()
+	root, err := d.value()
+	if err == nil {
+		if _, err = d.dec.Token(); err == io.EOF {
+			return root, nil
+		} else if err == nil {
+			err = errors.New("unexpected data after the top-level value")
+		}
+	}
+	var syntaxErr *json.SyntaxError
+	offset := d.dec.InputOffset()
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset > 0 {
+		offset = syntaxErr.Offset - 1 // the offset is just past the bad character
+	}
+	line, column := d.position(offset)
+	return nil, ErrorList{{Line: line, Column: column, Msg: err.Error()}}
+}
+
+type jsonDecoder struct {
+	dec  *json.Decoder
+	data []byte
+}
+
+// value decodes the next JSON value. Positions point at the value's first
+// character.
+func (d *jsonDecoder) value() (*yaml.Node, error) {
+	offset := d.next()
+	token, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	node := &yaml.Node{}
+	node.Line, node.Column = d.position(offset)
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			node.Kind = yaml.SequenceNode
+			for d.dec.More() {
+				item, err := d.value()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, item)
+			}
+		} else {
+			node.Kind = yaml.MappingNode
+			for d.dec.More() {
+				key, err := d.value()
+				if err != nil {
+					return nil, err
+				}
+				value, err := d.value()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, key, value)
+			}
+		}
+		_, err = d.dec.Token() // the closing delimiter
+		return node, err
+	case nil:
+		node.Kind, node.Tag = yaml.ScalarNode, "!!null"
+	case string:
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!str", token
+	default:
+		node.Kind, node.Value = yaml.ScalarNode, fmt.Sprint(token)
+	}
+	return node, nil
+}
+
+// next returns the offset of the next token, skipping the whitespace and
+// separators the decoder has not consumed yet.
+func (d *jsonDecoder) next() int64 {
+	offset := d.dec.InputOffset()
+	for offset < int64(len(d.data)) && strings.IndexByte(" \t\r\n,:", d.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// position converts a byte offset into a 1-based line and column.
+func (d *jsonDecoder) position(offset int64) (int, int) {
+	if offset > int64(len(d.data)) {
+		offset = int64(len(d.data))
+	}
+	before := d.data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	return line, column
+}
@@ -0,0 +1,178 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseAs_Document tests that YAML and JSON documents describe the same tree.
+func TestParseAs_Document(t *testing.T) {
+	type want struct {
+		kind    Kind
+		content string
+		source  string
+		target  string
+		mode    fs.FileMode
+		literal bool
+	}
+	expected := map[string]want{
+		"src":          {kind: Dir},
+		"src/main.go":  {kind: File, content: "package main\n"},
+		"src/empty":    {kind: Dir},
+		"bin":          {kind: Dir, mode: 0750},
+		"bin/run.sh":   {kind: File, content: "#!/bin/sh\n", mode: 0755},
+		"Makefile":     {kind: File, source: "templates/Makefile", literal: true},
+		"README.md":    {kind: File},
+		"v1.2":         {kind: Dir},
+		"v1.2/LICENSE": {kind: File},
+		"v1.2/notes.d": {kind: Dir},
+		"latest":       {kind: Symlink, target: "v1.2"},
+		"notes.txt":    {kind: File, mode: 0600},
+		"cache":        {kind: Dir, mode: 0700},
+	}
+	order := []string{"src", "src/main.go", "src/empty", "bin", "bin/run.sh", "Makefile", "README.md", "v1.2", "v1.2/LICENSE", "v1.2/notes.d", "latest", "notes.txt", "cache"}
+
+	documents := map[Format]string{
+		FormatYAML: `
+src:
+  main.go: |
+    package main
+  empty: {}
+bin:
+  $mode: "0750"
+  run.sh:
+    $content: "#!/bin/sh\n"
+    $mode: "0755"
+Makefile:
+  $source: templates/Makefile
+  $render: false
+README.md: ~
+v1.2:
+  LICENSE: ""
+  notes.d: {}
+latest:
+  $link: v1.2
+notes.txt:
+  $mode: "0600"
+  $size: 5
+  $mtime: "2024-10-13T09:30:00Z"
+cache/:
+  $mode: "0700"
+`,
+		FormatJSON: `{
+	"src": {"main.go": "package main\n", "empty": {}},
+	"bin": {"$mode": "0750", "run.sh": {"$content": "#!\/bin\/sh\n", "$mode": "755"}},
+	"Makefile": {"$source": "templates/Makefile", "$render": false},
+	"README.md": null,
+	"v1.2": {"LICENSE": "", "notes.d": {}},
+	"latest": {"$link": "v1.2"},
+	"notes.txt": {"$mode": "0600", "$size": 5},
+	"cache/": {"$mode": "0700", "$mtime": "2024-10-13T09:30:00+02:00"}
+}`,
+	}
+
+	for format, document := range documents {
+		lines := strings.Split(document, "\n")
+		nodes, err := ParseAs(lines, format)
+		if err != nil {
+			t.Errorf("ParseAs(%s) unexpected error: %v", format, err)
+			continue
+		}
+		var got []string
+		Walk(nodes, func(path string, node *Node) error {
+			path = filepath.ToSlash(path)
+			got = append(got, path)
+			w := expected[path]
+			if node.Kind != w.kind || node.Content != w.content || node.Source != w.source || node.Target != w.target || node.Mode != w.mode || node.Literal != w.literal {
+				t.Errorf("ParseAs(%s) %s = {%s %q %q %q %04o %v}; want {%s %q %q %q %04o %v}", format, path,
+					node.Kind, node.Content, node.Source, node.Target, node.Mode, node.Literal, w.kind, w.content, w.source, w.target, w.mode, w.literal)
+			}
+			return nil
+		})
+		if strings.Join(got, " ") != strings.Join(order, " ") {
+			t.Errorf("ParseAs(%s) paths = %q; want %q", format, got, order)
+		}
+	}
+}
+
+// TestParseAs_DocumentErrors tests that malformed documents are reported with their position.
+func TestParseAs_DocumentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		document string
+		line     int
+		column   int
+	}{
+		{"YAML syntax", FormatYAML, "src:\n  a: b\n   c: d", 3, 1},
+		{"JSON syntax", FormatJSON, "{\n  \"src\": {,}\n}", 2, 11},
+		{"Not a mapping", FormatYAML, "- src\n- docs", 1, 1},
+		{"List entry", FormatJSON, "{\n  \"src\": [\"main.go\"]\n}", 2, 10},
+		{"Invalid name", FormatYAML, "src:\n  ../escape: x", 2, 3},
+		{"Duplicate name", FormatJSON, "{\"a\": null,\n \"a\": {}}", 2, 2},
+		{"Bad mode", FormatYAML, "run.sh:\n  $content: x\n  $mode: rwx", 3, 10},
+		{"Render without a source", FormatYAML, "run.sh:\n  $content: x\n  $render: false", 3, 12},
+		{"Bad render", FormatYAML, "run.sh:\n  $source: x\n  $render: maybe", 3, 12},
+		{"Bad size", FormatYAML, "run.sh:\n  $size: 2K", 2, 10},
+		{"Bad modification time", FormatYAML, "run.sh:\n  $mtime: yesterday", 2, 11},
+		{"Content in a directory", FormatYAML, "src/: text", 1, 7},
+		{"Link marked as a directory", FormatYAML, "bin/:\n  $link: ../bin", 2, 3},
+		{"Unknown attribute", FormatYAML, "src:\n  $owner: root", 2, 3},
+		{"Attribute at the top", FormatYAML, "$mode: \"0755\"", 1, 1},
+		{"Children under a file", FormatYAML, "run.sh:\n  $content: x\n  nested: y", 3, 3},
+		{"Children under a link", FormatYAML, "bin:\n  $link: ../bin\n  nested: y", 3, 3},
+		{"Empty link", FormatJSON, "{\"bin\": {\"$link\": \"\"}}", 1, 19},
+		{"Link with content", FormatYAML, "bin:\n  $link: x\n  $content: y", 2, 3},
+	}
+
+	for _, test := range tests {
+		_, err := ParseAs(strings.Split(test.document, "\n"), test.format)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != test.line || parseErr.Column != test.column {
+			t.Errorf("%s: expected a parse error at %d:%d, got %v", test.name, test.line, test.column, err)
+		}
+	}
+}
+
+// TestFormatForPath tests format selection by file extension.
+func TestFormatForPath(t *testing.T) {
+	tests := map[string]Format{
+		"layout.yaml":     FormatYAML,
+		"layout.YML":      FormatYAML,
+		"dir/layout.json": FormatJSON,
+		"structure.txt":   FormatAuto,
+		"structure":       FormatAuto,
+	}
+	for path, expected := range tests {
+		if format := FormatForPath(path); format != expected {
+			t.Errorf("FormatForPath(%q) = %s; want %s", path, format, expected)
+		}
+	}
+}
+
+// TestParseMode tests octal mode parsing.
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected fs.FileMode
+		valid    bool
+	}{
+		{"0755", 0755, true},
+		{"644", 0644, true},
+		{"0o600", 0600, true},
+		{"0", 0, true},
+		{"", 0, false},
+		{"0888", 0, false},
+		{"01777", 0, false},
+		{"rwx", 0, false},
+	}
+	for _, test := range tests {
+		mode, err := ParseMode(test.input)
+		if (err == nil) != test.valid || mode != test.expected {
+			t.Errorf("ParseMode(%q) = %04o, %v; want %04o, valid %t", test.input, mode, err, test.expected, test.valid)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a problem at a specific position in the structure.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+// Error formats the error as "line L, column C: message".
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ErrorList collects every ParseError found in a structure.
+type ErrorList []*ParseError
+
+// Error lists each parse error on its own line.
+func (l ErrorList) Error() string {
+	if len(l) == 1 {
+		return l[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d parse errors:", len(l))
+	for _, err := range l {
+		b.WriteString("\n  ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap exposes the individual parse errors to errors.As.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, err := range l {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,99 @@
+package spec
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// char is a rune of an entry name together with whether it was escaped with
+// a backslash, and its byte offset in the raw text.
+type char struct {
+	r       rune
+	escaped bool
+	offset  int
+}
+
+// scanChars splits raw text into chars, resolving backslash escapes. A
+// trailing lone backslash is kept as a literal.
+func scanChars(raw string) []char {
+	var chars []char
+	for i := 0; i < len(raw); {
+		r, size := utf8.DecodeRuneInString(raw[i:])
+		if r == '\\' && i+size < len(raw) {
+			next, nextSize := utf8.DecodeRuneInString(raw[i+size:])
+			chars = append(chars, char{r: next, escaped: true, offset: i})
+			i += size + nextSize
+			continue
+		}
+		chars = append(chars, char{r: r, offset: i})
+		i += size
+	}
+	return chars
+}
+
+// trimChars drops unescaped spaces and tabs from both ends.
+func trimChars(chars []char) []char {
+	for len(chars) > 0 && isBlank(chars[0]) {
+		chars = chars[1:]
+	}
+	for len(chars) > 0 && isBlank(chars[len(chars)-1]) {
+		chars = chars[:len(chars)-1]
+	}
+	return chars
+}
+
+func isBlank(c char) bool {
+	return !c.escaped && (c.r == ' ' || c.r == '\t')
+}
+
+// cutMarker removes an unescaped marker such as ":file" from the end of chars.
+func cutMarker(chars []char, marker string) ([]char, bool) {
+	markerRunes := []rune(marker)
+	if len(chars) < len(markerRunes) {
+		return chars, false
+	}
+	tail := chars[len(chars)-len(markerRunes):]
+	for i, c := range tail {
+		if c.escaped || c.r != markerRunes[i] {
+			return chars, false
+		}
+	}
+	return trimChars(chars[:len(chars)-len(markerRunes)]), true
+}
+
+func charsString(chars []char) string {
+	var b strings.Builder
+	for _, c := range chars {
+		b.WriteRune(c.r)
+	}
+	return b.String()
+}
+
+// escapeName backslash-escapes every character of name that the parser
+// would otherwise read as syntax: backslashes and "<" anywhere, the dash of
+// a "->" arrow, leading dashes, blanks and "{" (which Detect takes for JSON),
+// trailing blanks, the colon of a trailing marker, and a closing "]" that
+// would end an attribute block.
+func escapeName(name string) string {
+	runes := []rune(name)
+	attributeLike := strings.Contains(name, " [") || strings.Contains(name, "\t[")
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case r == '\\' || r == '<',
+			r == '-' && i+1 < len(runes) && runes[i+1] == '>',
+			i == 0 && (r == '-' || r == ' ' || r == '\t' || r == '{'),
+			i == len(runes)-1 && (r == ' ' || r == '\t' || (r == ']' && attributeLike)),
+			r == ':' && endsWithMarker(string(runes[i:])):
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// endsWithMarker reports whether s, the tail of a name, would be read as a
+// kind marker.
+func endsWithMarker(s string) bool {
+	return s == fileSuffix || s == dirSuffix
+}
@@ -0,0 +1,203 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format names a structure syntax.
+type Format string
+
+const (
+	// FormatAuto picks the format with Detect.
+	FormatAuto Format = "auto"
+	// FormatDash is the native format, one leading dash per level.
+	FormatDash Format = "dash"
+	// FormatIndent nests entries by space or tab indentation, optionally as
+	// a "-", "*" or "+" bulleted list.
+	FormatIndent Format = "indent"
+	// FormatTree reads the output of the Unix tree command.
+	FormatTree Format = "tree"
+	// FormatYAML reads a YAML mapping of names to entries.
+	FormatYAML Format = "yaml"
+	// FormatJSON reads a JSON object of names to entries.
+	FormatJSON Format = "json"
+)
+
+// Formats lists the formats accepted by ParseFormat.
+var Formats = []Format{FormatAuto, FormatDash, FormatIndent, FormatTree, FormatYAML, FormatJSON}
+
+// ParseFormat validates a format name given on the command line.
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatAuto, nil
+	}
+	for _, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unknown format %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// FormatForPath picks the format of a structure file from its extension:
+// yaml for ".yaml" and ".yml", json for ".json", and auto otherwise.
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	}
+	return FormatAuto
+}
+
+// ParseAs parses lines written in format. In the indent and tree formats an
+// entry with children is a directory and a leaf is a file, unless it is
+// marked with a trailing "/", ":dir" or ":file".
+func ParseAs(lines []string, format Format) ([]*Node, error) {
+	if format == FormatAuto || format == "" {
+		format = Detect(lines)
+	}
+	switch format {
+	case FormatDash:
+		return parse(lines, splitDash, false)
+	case FormatIndent:
+		return parse(lines, newIndentSplitter(), true)
+	case FormatTree:
+		return parse(lines, newTreeSplitter(), true)
+	case FormatYAML, FormatJSON:
+		return parseDocument(lines, format)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// treeConnectors are the branch markers printed by tree, in its default and
+// --charset=ascii styles.
+var treeConnectors = []string{"├──", "└──", "|--", "`--"}
+
+// Detect guesses the format of lines: json when they open with "{" and are
+// valid JSON, tree when they contain tree branch connectors, indent when
+// entries are indented without dashes, and dash otherwise. Content blocks are
+// not looked at. YAML is only chosen by FormatForPath or by name.
+func Detect(lines []string) Format {
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			if strings.HasPrefix(line, "{") && json.Valid([]byte(strings.Join(lines, "\n"))) {
+				return FormatJSON
+			}
+			break
+		}
+	}
+	indented, dashed := false, false
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if _, _, ok := cutConnector(line); ok {
+			return FormatTree
+		}
+		body := strings.TrimLeft(line, " \t")
+		switch {
+		case strings.HasPrefix(body, "-") && !strings.HasPrefix(body, "- "),
+			strings.HasPrefix(body, "--"):
+			dashed = true
+		case len(body) < len(line):
+			indented = true
+		}
+		if delimiter := ParseLine(line).Heredoc; delimiter != "" {
+			_, i, _ = readContent(lines, i, delimiter)
+		}
+	}
+	if indented && !dashed {
+		return FormatIndent
+	}
+	return FormatDash
+}
+
+// tabWidth is the number of columns a tab counts for in the indent format.
+const tabWidth = 4
+
+// newIndentSplitter returns a splitter for the indent format. Levels are
+// tracked like Python blocks, so any consistent indentation works, and a
+// dedent must return to a level used before.
+func newIndentSplitter() lineSplitter {
+	var levels []int
+	return func(line string) (int, string, string) {
+		width := 0
+		body := line
+		for len(body) > 0 && (body[0] == ' ' || body[0] == '\t') {
+			if body[0] == '\t' {
+				width += tabWidth
+			} else {
+				width++
+			}
+			body = body[1:]
+		}
+		for _, bullet := range []string{"- ", "* ", "+ "} {
+			if strings.HasPrefix(body, bullet) {
+				body = strings.TrimLeft(body[len(bullet):], " \t")
+				break
+			}
+		}
+		if len(levels) == 0 {
+			levels = append(levels, width)
+		}
+		for width < levels[len(levels)-1] {
+			levels = levels[:len(levels)-1]
+			if len(levels) == 0 || width > levels[len(levels)-1] {
+				return 0, "", "indentation does not match any outer level"
+			}
+		}
+		if width > levels[len(levels)-1] {
+			levels = append(levels, width)
+		}
+		return len(levels) - 1, body, ""
+	}
+}
+
+// treeSummary matches the "N directories, M files" footer printed by tree.
+var treeSummary = regexp.MustCompile(`^\d+ director(y|ies)(, \d+ files?)?$`)
+
+// newTreeSplitter returns a splitter for tree output. The first line without
+// a connector is the root and is skipped, as is the summary footer.
+func newTreeSplitter() lineSplitter {
+	seenRoot := false
+	return func(line string) (int, string, string) {
+		prefix, rest, ok := cutConnector(line)
+		if !ok {
+			trimmed := strings.TrimSpace(line)
+			if !seenRoot || treeSummary.MatchString(trimmed) {
+				seenRoot = true
+				return -1, "", ""
+			}
+			return 0, "", "expected a tree branch such as \"├── name\""
+		}
+		seenRoot = true
+		// Every level of the prefix is four columns wide, such as "│   " or
+		// "    ", and newer versions of tree use non-breaking spaces in it
+		return utf8.RuneCountInString(prefix) / 4, strings.TrimLeft(rest, " \u00a0"), ""
+	}
+}
+
+// cutConnector splits a tree line around its branch connector.
+func cutConnector(line string) (prefix, rest string, ok bool) {
+	for _, connector := range treeConnectors {
+		if i := strings.Index(line, connector); i >= 0 {
+			prefix := line[:i]
+			if strings.Trim(prefix, " \u00a0│|") == "" {
+				return prefix, line[i+len(connector):], true
+			}
+		}
+	}
+	return "", "", false
+}
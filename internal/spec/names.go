@@ -0,0 +1,54 @@
+package spec
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// windowsReserved are the device names Windows reserves in every directory,
+// with or without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// ValidateName reports why name cannot be created as a single entry inside
+// its parent directory, or returns nil. Names must not be empty, "." or
+// "..", and must not contain a slash, a NUL byte or a line break, so that
+// no entry can point outside the root it is built in. On Windows,
+// backslashes, drive colons, the other characters Windows forbids and its
+// reserved device names are rejected as well.
+func ValidateName(name string) error {
+	return validateName(name, runtime.GOOS == "windows")
+}
+
+func validateName(name string, windows bool) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("missing entry name")
+	case name == "." || name == "..":
+		return fmt.Errorf("entry name %q refers to a directory itself, not an entry in it", name)
+	case strings.Contains(name, "/"):
+		return fmt.Errorf("entry name %q contains a path separator", name)
+	case strings.ContainsRune(name, 0):
+		return fmt.Errorf("entry name %q contains a NUL byte", name)
+	case strings.ContainsAny(name, "\r\n"):
+		return fmt.Errorf("entry name %q contains a line break", name)
+	}
+	if !windows {
+		return nil
+	}
+	if i := strings.IndexFunc(name, func(r rune) bool { return r < 32 || strings.ContainsRune(`\:<>"|?*`, r) }); i >= 0 {
+		return fmt.Errorf("entry name %q contains %q, which Windows does not allow", name, name[i])
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("entry name %q ends with a dot or space, which Windows drops", name)
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return fmt.Errorf("entry name %q is a device name reserved by Windows", name)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package spec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestValidateName tests the names accepted on every platform and on Windows.
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		valid   bool // on every platform but Windows
+		windows bool // on Windows
+	}{
+		{"main.go", true, true},
+		{".github", true, true},
+		{"..hidden", true, true},
+		{"a..b", true, true},
+		{"[id].tsx", true, true},
+		{"auxiliary.go", true, true},
+		{"com10", true, true},
+		{"", false, false},
+		{".", false, false},
+		{"..", false, false},
+		{"../etc", false, false},
+		{"/etc/passwd", false, false},
+		{"a/b", false, false},
+		{"nul\x00byte", false, false},
+		{"line\nbreak", false, false},
+		{"carriage\rreturn", false, false},
+		{`back\slash`, true, false},
+		{`..\..\evil`, true, false},
+		{"C:evil", true, false},
+		{"what?", true, false},
+		{"a*b", true, false},
+		{`quote"d`, true, false},
+		{"a|b", true, false},
+		{"a<b>", true, false},
+		{"bell\a", true, false},
+		{"trailing.", true, false},
+		{"trailing ", true, false},
+		{"CON", true, false},
+		{"con", true, false},
+		{"nul.txt", true, false},
+		{"Aux.tar.gz", true, false},
+		{"COM1", true, false},
+		{"lpt9.log", true, false},
+		{"prn .txt", true, false},
+	}
+
+	for _, test := range tests {
+		if err := validateName(test.name, false); (err == nil) != test.valid {
+			t.Errorf("validateName(%q, false) = %v; want valid %v", test.name, err, test.valid)
+		}
+		if err := validateName(test.name, true); (err == nil) != test.windows {
+			t.Errorf("validateName(%q, true) = %v; want valid %v", test.name, err, test.windows)
+		}
+	}
+}
+
+// TestParse_UnsafeNames tests that every format rejects names that would
+// escape the root, at the position of the name.
+func TestParse_UnsafeNames(t *testing.T) {
+	tests := []struct {
+		format   Format
+		document string
+		line     int
+		column   int
+	}{
+		{FormatDash, "src\n-- ../../etc/evil:file", 2, 4},
+		{FormatDash, "src\n-../escape/", 2, 2},
+		{FormatDash, "/etc/passwd:file", 1, 1},
+		{FormatDash, "..", 1, 1},
+		{FormatDash, "src\n-.. -> /etc", 2, 2},
+		{FormatDash, "a/b <<EOF\ncontent\nEOF", 1, 1},
+		{FormatIndent, "src\n  ../../evil.sh", 2, 3},
+		{FormatTree, ".\n└── ../evil.sh", 2, 5},
+		{FormatYAML, "src:\n  ../evil: x", 2, 3},
+		{FormatYAML, "\"/abs\": null", 1, 1},
+		{FormatYAML, "\"nul\\0byte\": null", 1, 1},
+		{FormatJSON, "{\"src\": {\"..\": {}}}", 1, 10},
+		{FormatJSON, "{\"a\\nb\": null}", 1, 2},
+	}
+
+	for _, test := range tests {
+		_, err := ParseAs(strings.Split(test.document, "\n"), test.format)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != test.line || parseErr.Column != test.column {
+			t.Errorf("ParseAs(%q, %s) = %v; want a parse error at %d:%d", test.document, test.format, err, test.line, test.column)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// Package spec parses and formats the dash-indented project structure format:
+//
+//	src
+//	-main.go
+//	-internal
+//	--helper.go
+//	README:file
+//
+// Each leading dash nests an entry one level deeper. Names containing a dot, or
+// ending in ":file", are files; everything else is a directory. A trailing
+// "/" (or a ":dir" suffix) forces a directory, for names such as "v1.2/" or
+// ".github/".
+//
+// A backslash makes the next character part of the name, so names that start
+// with a dash, have surrounding blanks or contain "<" can still be written,
+// e.g. "\-flag" or "notes\:file:dir".
+//
+// A file can carry its content inline in a heredoc block, or load it from
+// another file:
+//
+//	main.go <<EOF
+//	package main
+//	EOF
+//	Makefile < templates/Makefile
+//
+// An entry written "name -> target" is a symbolic link to target, which is
+// taken verbatim.
+//
+// Attributes in brackets after a name set properties of the entry; "mode"
+// gives its permission bits in octal, "render=false" copies a content source
+// as it is, and the "size" and "mtime" written by `mkproj tree` are checked
+// and ignored:
+//
+//	scripts
+//	-deploy.sh [mode=0755]
+//	secrets/ [mode=0700]
+package spec
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// fileSuffix marks an entry as a file when its name has no extension.
+	fileSuffix = ":file"
+	// dirSuffix marks an entry as a directory when its name contains a dot.
+	dirSuffix = ":dir"
+	// dirSlash is the shorter directory marker, and the one FormatLine writes.
+	dirSlash = "/"
+)
+
+// Kind tells directories and files apart.
+type Kind int
+
+const (
+	// Dir is a directory entry that may have children.
+	Dir Kind = iota
+	// File is a regular file entry.
+	File
+	// Symlink is a symbolic link entry.
+	Symlink
+)
+
+// String returns "dir", "file" or "symlink".
+func (k Kind) String() string {
+	switch k {
+	case File:
+		return "file"
+	case Symlink:
+		return "symlink"
+	}
+	return "dir"
+}
+
+// ModeKind names the kind of an entry on disk with the given mode, "dir",
+// "file" or "symlink" like Kind.String, or "other" for devices, pipes and
+// sockets.
+func ModeKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return Symlink.String()
+	case mode.IsDir():
+		return Dir.String()
+	case mode.IsRegular():
+		return File.String()
+	}
+	return "other"
+}
+
+// Entry is the result of parsing a single line on its own. Heredoc holds the
+// delimiter of an inline content block that starts on the next line, Source
+// the path given after "<" and Target the path given after "->". Mode holds
+// the permission bits of a "[mode=...]" attribute, or 0, and Literal is set
+// by "[render=false]".
+type Entry struct {
+	Depth   int
+	Name    string
+	Kind    Kind
+	Column  int
+	Heredoc string
+	Source  string
+	Target  string
+	Mode    fs.FileMode
+	Literal bool
+
+	redirect bool        // an unescaped "<" was found
+	explicit bool        // the kind comes from a marker or content, not the name
+	attrErr  *ParseError // a malformed attribute block, positioned on the line
+}
+
+// Node is an entry placed in the structure tree. Content is the inline body
+// of a file and Source the path its body should be loaded from; at most one
+// of them is set. Target is where a symlink points. Mode holds permission
+// bits to apply, or 0 for the default. Literal keeps the content loaded from
+// Source from being rendered as a template.
+type Node struct {
+	Name     string
+	Kind     Kind
+	Depth    int
+	Line     int
+	Column   int
+	Content  string
+	Source   string
+	Target   string
+	Mode     fs.FileMode
+	Literal  bool
+	Children []*Node
+
+	explicit bool
+}
+
+// CountDepth counts the leading dashes of a line, ignoring spaces and tabs
+// between them.
+func CountDepth(line string) int {
+	count := 0
+	for _, char := range line {
+		if char == '-' {
+			count++
+		} else if char == ' ' || char == '\t' {
+			continue
+		} else {
+			break
+		}
+	}
+	return count
+}
+
+// ParseLine splits a single line into its depth, name and kind. Column is the
+// 1-based position of the name, or 0 when the line has no name.
+func ParseLine(line string) Entry {
+	line = strings.TrimRight(line, "\r\n")
+	return parseEntry(line, strings.TrimLeft(line, "- \t"), CountDepth(line))
+}
+
+// parseEntry parses rest, the part of line after its indentation, as the
+// name of an entry at depth.
+func parseEntry(line, rest string, depth int) Entry {
+	entry := Entry{Depth: depth}
+	if strings.TrimSpace(rest) == "" {
+		return entry
+	}
+	entry.Column = utf8.RuneCountInString(line[:len(line)-len(rest)]) + 1
+	chars := scanChars(rest)
+	for i, c := range chars {
+		if c.r == '-' && !c.escaped && i+1 < len(chars) && chars[i+1].r == '>' {
+			// Everything after the arrow is the target, taken verbatim
+			entry.Kind = Symlink
+			entry.explicit = true
+			entry.Target = strings.TrimSpace(rest[chars[i+1].offset+1:])
+			entry.Name = charsString(trimChars(chars[:i]))
+			return entry
+		}
+		if c.r != '<' || c.escaped {
+			continue
+		}
+		redirect := rest[c.offset:]
+		entry.redirect = true
+		if strings.HasPrefix(redirect, "<<") {
+			entry.Heredoc = strings.TrimSpace(redirect[2:])
+		} else {
+			entry.Source = strings.TrimSpace(redirect[1:])
+		}
+		// Only files have content, whatever their name looks like
+		entry.Kind = File
+		entry.explicit = true
+		chars = chars[:i]
+		break
+	}
+	chars = trimChars(chars)
+	if name, text, i, ok := cutAttributes(chars); ok {
+		if err := parseAttributes(text, &entry); err != nil {
+			column := utf8.RuneCountInString(line[:len(line)-len(rest)+chars[i].offset]) + 1
+			entry.attrErr = &ParseError{Column: column, Msg: err.Error()}
+		}
+		chars = name
+	}
+	if name, ok := cutMarker(chars, fileSuffix); ok {
+		entry.Kind = File
+		entry.explicit = true
+		chars = name
+	} else if name, ok := cutMarker(chars, dirSlash); ok && entry.Kind != File {
+		entry.explicit = true
+		chars = name
+	} else if name, ok := cutMarker(chars, dirSuffix); ok && entry.Kind != File {
+		entry.explicit = true
+		chars = name
+	} else if strings.Contains(charsString(chars), ".") {
+		entry.Kind = File
+	}
+	entry.Name = charsString(chars)
+	return entry
+}
+
+// FormatLine is the inverse of ParseLine: it renders an entry at depth,
+// escaping the name where needed and adding a ":file" suffix or a trailing
+// "/" when the name alone would read as the other kind.
+func FormatLine(depth int, name string, kind Kind) string {
+	line := strings.Repeat("-", depth) + escapeName(name)
+	hasDot := strings.Contains(name, ".")
+	if kind == File && !hasDot {
+		line += fileSuffix
+	} else if kind == Dir && hasDot {
+		line += dirSlash
+	}
+	return line
+}
+
+// FormatLink renders a symlink entry at depth, the inverse of ParseLine for
+// "name -> target" lines.
+func FormatLink(depth int, name, target string) string {
+	return strings.Repeat("-", depth) + escapeName(name) + " -> " + target
+}
+
+// CanFormat reports whether name can be written as a single entry line.
+// Names must be usable as one path element.
+func CanFormat(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00\r\n")
+}
+
+// CanFormatTarget reports whether a symlink target can be written after
+// "->". Targets are kept verbatim but for surrounding blanks.
+func CanFormatTarget(target string) bool {
+	return target != "" && target == strings.TrimSpace(target) && !strings.ContainsAny(target, "\x00\r\n")
+}
+
+// Parse builds the structure tree described by lines in the dash format and
+// returns its top-level entries. Blank lines are ignored. Every problem found
+// is reported in an ErrorList.
+func Parse(lines []string) ([]*Node, error) {
+	return parse(lines, splitDash, false)
+}
+
+// lineSplitter finds the depth of an entry line and the text after its
+// indentation. A negative depth skips the line; a non-empty msg rejects it.
+type lineSplitter func(line string) (depth int, rest string, msg string)
+
+// splitDash reads depth from leading dashes.
+func splitDash(line string) (int, string, string) {
+	return CountDepth(line), strings.TrimLeft(line, "- \t"), ""
+}
+
+// parse is shared by all line-based formats. When structural is set, an
+// entry's kind comes from the tree rather than its name: entries with
+// children are directories and leaves are files, unless a marker says
+// otherwise.
+func parse(lines []string, split lineSplitter, structural bool) ([]*Node, error) {
+	var roots []*Node
+	var stack []*Node // open directories, stack[i] is at depth i
+	var errs ErrorList
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lineNo := i + 1
+		depth, rest, msg := split(line)
+		if msg != "" {
+			errs = append(errs, &ParseError{Line: lineNo, Column: 1, Msg: msg})
+			continue
+		}
+		if depth < 0 {
+			continue
+		}
+		entry := parseEntry(line, rest, depth)
+		if entry.Kind == Symlink && entry.Target == "" {
+			errs = append(errs, &ParseError{Line: lineNo, Column: entry.Column, Msg: "missing symlink target after \"->\""})
+			continue
+		}
+		if entry.attrErr != nil {
+			entry.attrErr.Line = lineNo
+			errs = append(errs, entry.attrErr)
+			continue
+		}
+		if entry.redirect && entry.Heredoc == "" && entry.Source == "" {
+			errs = append(errs, &ParseError{Line: lineNo, Column: entry.Column, Msg: "missing content delimiter or source path after \"<\""})
+			continue
+		}
+		content, end, err := readContent(lines, i, entry.Heredoc)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		i = end
+		if entry.Name == "" {
+			errs = append(errs, &ParseError{Line: lineNo, Column: utf8.RuneCountInString(line) + 1, Msg: "missing entry name"})
+			continue
+		}
+		if err := ValidateName(entry.Name); err != nil {
+			errs = append(errs, &ParseError{Line: lineNo, Column: entry.Column, Msg: err.Error()})
+			continue
+		}
+		if entry.Depth > len(stack) {
+			msg := fmt.Sprintf("entry is nested %d levels deep but its parent allows at most %d", entry.Depth, len(stack))
+			if len(stack) > 0 {
+				msg += fmt.Sprintf(" (under %q)", stack[len(stack)-1].Name)
+			}
+			errs = append(errs, &ParseError{Line: lineNo, Column: entry.Column, Msg: msg})
+			continue
+		}
+		node := &Node{Name: entry.Name, Kind: entry.Kind, Depth: entry.Depth, Line: lineNo, Column: entry.Column, Content: content, Source: entry.Source, Target: entry.Target, Mode: entry.Mode, Literal: entry.Literal, explicit: entry.explicit}
+		stack = stack[:entry.Depth]
+		siblings := &roots
+		if entry.Depth > 0 {
+			siblings = &stack[entry.Depth-1].Children
+		}
+		if hasNode(*siblings, node.Name) {
+			// Its children are still read, to report their errors in place
+			errs = append(errs, &ParseError{Line: lineNo, Column: entry.Column, Msg: fmt.Sprintf("duplicate entry %q", node.Name)})
+		} else {
+			*siblings = append(*siblings, node)
+		}
+		if node.Kind == Dir || (structural && !node.explicit) {
+			stack = append(stack, node)
+		}
+	}
+	if structural {
+		inferKinds(roots)
+	}
+	if len(errs) > 0 {
+		return roots, errs
+	}
+	return roots, nil
+}
+
+// hasNode reports whether nodes has one called name.
+func hasNode(nodes []*Node, name string) bool {
+	for _, node := range nodes {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// inferKinds sets the kind of unmarked nodes from their place in the tree.
+func inferKinds(nodes []*Node) {
+	for _, node := range nodes {
+		if !node.explicit {
+			node.Kind = File
+			if len(node.Children) > 0 {
+				node.Kind = Dir
+			}
+		}
+		inferKinds(node.Children)
+	}
+}
+
+// readContent collects the heredoc block opened on lines[start], returning the
+// block and the index of its closing delimiter. Lines inside the block are
+// kept verbatim.
+func readContent(lines []string, start int, delimiter string) (string, int, *ParseError) {
+	if delimiter == "" {
+		return "", start, nil
+	}
+	var body strings.Builder
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		if strings.TrimSpace(line) == delimiter {
+			return body.String(), i, nil
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+	}
+	column := utf8.RuneCountInString(strings.TrimRight(lines[start], "\r\n")) - utf8.RuneCountInString(delimiter) + 1
+	return "", start, &ParseError{Line: start + 1, Column: column, Msg: fmt.Sprintf("content block is not closed by %q", delimiter)}
+}
+
+// Walk calls fn for every node in depth-first order, passing the node's path
+// relative to the structure root. Returning an error from fn stops the walk.
+func Walk(nodes []*Node, fn func(path string, node *Node) error) error {
+	return walk("", nodes, fn)
+}
+
+func walk(parent string, nodes []*Node, fn func(path string, node *Node) error) error {
+	for _, node := range nodes {
+		path := filepath.Join(parent, node.Name)
+		if err := fn(path, node); err != nil {
+			return err
+		}
+		if err := walk(path, node.Children, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,462 @@
+package spec
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// TestCountDepth tests the CountDepth function.
+func TestCountDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"---file.go", 3},
+		{"- dir", 1},
+		{"--nested", 2},
+		{"no-dashes", 0},
+		{" -mixed", 1},
+		{"", 0},
+		{"\t-tab", 1},
+	}
+
+	for _, test := range tests {
+		result := CountDepth(test.input)
+		if result != test.expected {
+			t.Errorf("CountDepth(%q) = %d; want %d", test.input, result, test.expected)
+		}
+	}
+}
+
+// TestParseLine tests the ParseLine function.
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedKind   Kind
+		expectedName   string
+		expectedColumn int
+	}{
+		{"-main.go", File, "main.go", 2},
+		{"--utils.go", File, "utils.go", 3},
+		{"-README:file", File, "README", 2},
+		{"--LICENSE:file", File, "LICENSE", 3},
+		{"-docs", Dir, "docs", 2},
+		{"--src", Dir, "src", 3},
+		{"-config", Dir, "config", 2},
+		{"-script.sh", File, "script.sh", 2},
+		{"-noextension:file", File, "noextension", 2},
+		{"-invalid:fileextra", Dir, "invalid:fileextra", 2}, // Edge case
+		{"-config.d/", Dir, "config.d", 2},
+		{"-v1.0 /", Dir, "v1.0", 2},
+		{".github:dir", Dir, ".github", 1},
+		{" -mixed", Dir, "mixed", 3},
+		{"- spaced.go", File, "spaced.go", 3},
+		{"", Dir, "", 0},
+		{"---", Dir, "", 0},
+	}
+
+	for _, test := range tests {
+		entry := ParseLine(test.input)
+		if entry.Kind != test.expectedKind || entry.Name != test.expectedName || entry.Column != test.expectedColumn {
+			t.Errorf("ParseLine(%q) = (%v, %q, %d); want (%v, %q, %d)", test.input, entry.Kind, entry.Name, entry.Column, test.expectedKind, test.expectedName, test.expectedColumn)
+		}
+	}
+}
+
+// TestFormatLine tests that FormatLine output parses back to the same entry.
+func TestFormatLine(t *testing.T) {
+	tests := []struct {
+		depth    int
+		name     string
+		kind     Kind
+		expected string
+	}{
+		{0, "src", Dir, "src"},
+		{1, "main.go", File, "-main.go"},
+		{2, "LICENSE", File, "--LICENSE:file"},
+		{1, ".gitignore", File, "-.gitignore"},
+		{0, ".github", Dir, ".github/"},
+		{1, "v1.2", Dir, "-v1.2/"},
+		{0, "-flag", File, "\\-flag:file"},
+		{0, " padded ", Dir, "\\ padded\\ "},
+		{0, "a<b.txt", File, "a\\<b.txt"},
+		{0, `back\slash`, Dir, `back\\slash`},
+		{0, "notes:file", Dir, "notes\\:file"},
+		{0, "x.y:dir", File, "x.y\\:dir"},
+		{0, "{}", Dir, "\\{}"},
+		{0, "a->b", Dir, "a\\->b"},
+	}
+
+	for _, test := range tests {
+		line := FormatLine(test.depth, test.name, test.kind)
+		if line != test.expected {
+			t.Errorf("FormatLine(%d, %q, %v) = %q; want %q", test.depth, test.name, test.kind, line, test.expected)
+		}
+		entry := ParseLine(line)
+		if entry.Depth != test.depth || entry.Name != test.name || entry.Kind != test.kind {
+			t.Errorf("ParseLine(%q) = %+v; want depth %d, name %q, kind %v", line, entry, test.depth, test.name, test.kind)
+		}
+	}
+}
+
+// TestParse tests that Parse builds the expected tree.
+func TestParse(t *testing.T) {
+	lines := []string{
+		"src",
+		"-main.go",
+		"-internal",
+		"--helper.go",
+		"",
+		"README:file",
+	}
+
+	nodes, err := Parse(lines)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	type visit struct {
+		path string
+		kind Kind
+		line int
+	}
+	expected := []visit{
+		{"src", Dir, 1},
+		{filepath.Join("src", "main.go"), File, 2},
+		{filepath.Join("src", "internal"), Dir, 3},
+		{filepath.Join("src", "internal", "helper.go"), File, 4},
+		{"README", File, 6},
+	}
+	var visited []visit
+	Walk(nodes, func(path string, node *Node) error {
+		visited = append(visited, visit{path, node.Kind, node.Line})
+		return nil
+	})
+	if len(visited) != len(expected) {
+		t.Fatalf("Expected %d nodes, got %d: %v", len(expected), len(visited), visited)
+	}
+	for i := range expected {
+		if visited[i] != expected[i] {
+			t.Errorf("Node %d = %+v; want %+v", i, visited[i], expected[i])
+		}
+	}
+}
+
+// TestParse_Errors tests that Parse reports every problem with its position.
+func TestParse_Errors(t *testing.T) {
+	lines := []string{
+		"src",
+		"---",
+		"-main.go",
+		"--nested.go",
+		"docs",
+		"---deep",
+		"src/",
+		"-main.go",
+		"link -> docs",
+		"link:file",
+	}
+
+	_, err := Parse(lines)
+
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Expected an ErrorList, got %v", err)
+	}
+	expected := []ParseError{
+		{Line: 2, Column: 4},
+		{Line: 4, Column: 3},
+		{Line: 6, Column: 4},
+		{Line: 7, Column: 1},
+		{Line: 10, Column: 1},
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(list), err)
+	}
+	for i, parseErr := range list {
+		if parseErr.Line != expected[i].Line || parseErr.Column != expected[i].Column {
+			t.Errorf("Error %d at line %d, column %d; want line %d, column %d", i, parseErr.Line, parseErr.Column, expected[i].Line, expected[i].Column)
+		}
+	}
+}
+
+// TestParse_Symlink tests "name -> target" entries.
+func TestParse_Symlink(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		target string
+	}{
+		{"current -> releases/v1.2", "current", "releases/v1.2"},
+		{"-bin->../tools/bin", "bin", "../tools/bin"},
+		{"lib.so -> lib.so.1  ", "lib.so", "lib.so.1"},
+		{"odd -> a -> b", "odd", "a -> b"},
+		{"spaced\\ -> x", "spaced ", "x"},
+	}
+
+	for _, test := range tests {
+		entry := ParseLine(test.line)
+		if entry.Kind != Symlink || entry.Name != test.name || entry.Target != test.target {
+			t.Errorf("ParseLine(%q) = (%v, %q, %q); want (symlink, %q, %q)", test.line, entry.Kind, entry.Name, entry.Target, test.name, test.target)
+		}
+		if line := FormatLink(entry.Depth, entry.Name, entry.Target); ParseLine(line) != entry {
+			t.Errorf("FormatLink(%d, %q, %q) = %q, which does not parse back", entry.Depth, entry.Name, entry.Target, line)
+		}
+	}
+
+	if entry := ParseLine("a\\->b"); entry.Kind != Dir || entry.Name != "a->b" {
+		t.Errorf("ParseLine(%q) = (%v, %q); want (dir, %q)", "a\\->b", entry.Kind, entry.Name, "a->b")
+	}
+
+	_, err := Parse([]string{"link ->", "dir -> target", "-child"})
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 2 || list[0].Line != 1 || list[1].Line != 3 {
+		t.Errorf("Expected errors on lines 1 and 3, got %v", err)
+	}
+}
+
+// TestParse_Attributes tests "[mode=...]" attribute blocks, and the size and
+// mtime attributes that are read and ignored.
+func TestParse_Attributes(t *testing.T) {
+	tests := []struct {
+		line string
+		name string
+		kind Kind
+		mode fs.FileMode
+	}{
+		{"deploy.sh [mode=0755]", "deploy.sh", File, 0755},
+		{"-secrets/ [mode=700]", "secrets", Dir, 0700},
+		{"README:file\t[mode=0o644]", "README", File, 0644},
+		{"run [ mode=0750 ]", "run", Dir, 0750},
+		{"main.go [mode=0600] <<EOF", "main.go", File, 0600},
+		{"--run.sh [mode=0755 size=22 mtime=2024-10-13T09:30:00+02:00]", "run.sh", File, 0755},
+		{"src [size=2048]", "src", Dir, 0},
+		{"[id].tsx", "[id].tsx", File, 0},
+		{"[slug]", "[slug]", Dir, 0},
+		{"draft [1\\]", "draft [1]", Dir, 0},
+	}
+
+	for _, test := range tests {
+		entry := ParseLine(test.line)
+		if entry.attrErr != nil || entry.Name != test.name || entry.Kind != test.kind || entry.Mode != test.mode {
+			t.Errorf("ParseLine(%q) = (%q, %v, %04o, %v); want (%q, %v, %04o)", test.line, entry.Name, entry.Kind, entry.Mode, entry.attrErr, test.name, test.kind, test.mode)
+		}
+		if test.mode == 0 {
+			continue
+		}
+		line := FormatLine(entry.Depth, entry.Name, entry.Kind) + FormatMode(entry.Mode)
+		if got := ParseLine(line); got.Name != entry.Name || got.Kind != entry.Kind || got.Mode != entry.Mode {
+			t.Errorf("ParseLine(%q) = %+v; want name %q, kind %v, mode %04o", line, got, entry.Name, entry.Kind, entry.Mode)
+		}
+	}
+
+	if line := FormatLine(0, "draft [1]", Dir); line != "draft [1\\]" {
+		t.Errorf("FormatLine(%q) = %q; want %q", "draft [1]", line, "draft [1\\]")
+	}
+
+	if entry := ParseLine("Makefile [render=false] < templates/Makefile"); entry.attrErr != nil || !entry.Literal || entry.Source != "templates/Makefile" {
+		t.Errorf("ParseLine(render=false) = %+v; want a literal source", entry)
+	}
+
+	_, err := Parse([]string{"a [mode=999]", "b [owner=root]", "c []", "d [mode]", "e [size=2K]", "f [mtime=yesterday]", "g [render=false]", "h [render=maybe] < h.txt"})
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 8 {
+		t.Fatalf("Expected 8 errors, got %v", err)
+	}
+	for i, parseErr := range list {
+		if parseErr.Line != i+1 || parseErr.Column != 3 {
+			t.Errorf("Error %d at line %d, column %d; want line %d, column 3", i, parseErr.Line, parseErr.Column, i+1)
+		}
+	}
+}
+
+// TestParse_Content tests heredoc blocks and content sources.
+func TestParse_Content(t *testing.T) {
+	lines := []string{
+		"cmd",
+		"-main.go <<EOF",
+		"package main",
+		"  -not an entry",
+		"EOF",
+		"Makefile < templates/Makefile",
+		"LICENSE:file <<END",
+		"END",
+	}
+
+	nodes, err := Parse(lines)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("Expected 3 top-level nodes, got %d", len(nodes))
+	}
+
+	main := nodes[0].Children[0]
+	if main.Name != "main.go" || main.Line != 2 || main.Content != "package main\n  -not an entry\n" {
+		t.Errorf("Unexpected heredoc node: %+v", main)
+	}
+	makefile := nodes[1]
+	if makefile.Name != "Makefile" || makefile.Kind != File || makefile.Source != "templates/Makefile" || makefile.Line != 6 {
+		t.Errorf("Unexpected source node: %+v", makefile)
+	}
+	license := nodes[2]
+	if license.Name != "LICENSE" || license.Kind != File || license.Content != "" {
+		t.Errorf("Unexpected empty heredoc node: %+v", license)
+	}
+}
+
+// TestParse_ContentErrors tests malformed content blocks.
+func TestParse_ContentErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		line  int
+	}{
+		{"Unclosed heredoc", []string{"src", "-main.go <<EOF", "package main"}, 2},
+		{"Missing source", []string{"main.go <"}, 1},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.lines)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != test.line {
+			t.Errorf("%s: expected a parse error at line %d, got %v", test.name, test.line, err)
+		}
+	}
+}
+
+// TestFormatLine_Property checks that ParseLine inverts FormatLine for any name.
+func TestFormatLine_Property(t *testing.T) {
+	property := func(name string, depth uint8, isFile bool) bool {
+		if !CanFormat(name) {
+			return true
+		}
+		kind := Dir
+		if isFile {
+			kind = File
+		}
+		entry := ParseLine(FormatLine(int(depth%8), name, kind))
+		return entry.Name == name && entry.Kind == kind && entry.Depth == int(depth%8)
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDetect tests format detection.
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected Format
+	}{
+		{"Dash", []string{"src", "-main.go", "--deep"}, FormatDash},
+		{"Dash with spaced first level", []string{"project-root", "- src", "-- main.go"}, FormatDash},
+		{"Single level dash", []string{"src", "- main.go"}, FormatDash},
+		{"Spaces", []string{"src/", "  main.go", "README.md"}, FormatIndent},
+		{"Tabs", []string{"src", "\tmain.go"}, FormatIndent},
+		{"Bullets", []string{"- src/", "  - main.go"}, FormatIndent},
+		{"Tree", []string{".", "├── src", "│   └── main.go", "└── go.mod"}, FormatTree},
+		{"ASCII tree", []string{".", "|-- src", "`-- go.mod"}, FormatTree},
+		{"JSON", []string{"{", `  "src": {}`, "}"}, FormatJSON},
+		{"Braces that are not JSON", []string{"{app}", "-main.go"}, FormatDash},
+		{"Indented content is ignored", []string{"main.go <<EOF", "  func main() {}", "EOF"}, FormatDash},
+	}
+
+	for _, test := range tests {
+		if format := Detect(test.lines); format != test.expected {
+			t.Errorf("%s: Detect() = %s; want %s", test.name, format, test.expected)
+		}
+	}
+}
+
+// TestParseAs tests that every format produces the same tree.
+func TestParseAs(t *testing.T) {
+	expected := []string{
+		"dir cmd",
+		"dir cmd/app",
+		"file cmd/app/main.go",
+		"dir v1.2",
+		"file v1.2/spec.yaml",
+		"file LICENSE",
+		"dir empty",
+	}
+	tests := []struct {
+		format Format
+		lines  []string
+	}{
+		{FormatDash, []string{"cmd", "-app", "--main.go", "v1.2/", "-spec.yaml", "LICENSE:file", "empty"}},
+		{FormatIndent, []string{"cmd", "  app", "    main.go", "v1.2", "  spec.yaml", "LICENSE", "empty/"}},
+		{FormatIndent, []string{"cmd", "\tapp", "\t\tmain.go", "v1.2", "\tspec.yaml", "LICENSE", "empty:dir"}},
+		{FormatIndent, []string{"- cmd/", "    - app/", "        - main.go", "- v1.2/", "    - spec.yaml", "- LICENSE", "- empty/"}},
+		{FormatTree, []string{
+			".",
+			"├── cmd",
+			"│   └── app",
+			"│       └── main.go",
+			"├── v1.2",
+			"│   └── spec.yaml",
+			"├── LICENSE",
+			"└── empty/",
+			"",
+			"4 directories, 3 files",
+		}},
+		{FormatTree, []string{
+			"project",
+			"|-- cmd",
+			"|   `-- app",
+			"|       `-- main.go",
+			"|-- v1.2",
+			"|   `-- spec.yaml",
+			"|-- LICENSE",
+			"`-- empty/",
+		}},
+		{FormatTree, []string{".", "├── cmd", "│   └── app", "│       └── main.go", "├── v1.2", "│   └── spec.yaml", "├── LICENSE", "└── empty/"}},
+	}
+
+	for _, test := range tests {
+		if detected := Detect(test.lines); detected != test.format {
+			t.Errorf("Detect(%q) = %s; want %s", test.lines, detected, test.format)
+		}
+		nodes, err := ParseAs(test.lines, test.format)
+		if err != nil {
+			t.Errorf("ParseAs(%s) unexpected error: %v", test.format, err)
+			continue
+		}
+		var got []string
+		Walk(nodes, func(path string, node *Node) error {
+			got = append(got, node.Kind.String()+" "+filepath.ToSlash(path))
+			return nil
+		})
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("ParseAs(%s) = %q; want %q", test.format, got, expected)
+		}
+	}
+}
+
+// TestParseAs_Errors tests errors specific to the indent and tree formats.
+func TestParseAs_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		lines  []string
+		line   int
+	}{
+		{"Dedent to an unknown level", FormatIndent, []string{"src", "    main.go", "  util.go"}, 3},
+		{"Nested under a marked file", FormatIndent, []string{"README:file", "  notes"}, 2},
+		{"Line without branch", FormatTree, []string{".", "├── src", "stray"}, 3},
+	}
+
+	for _, test := range tests {
+		_, err := ParseAs(test.lines, test.format)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != test.line {
+			t.Errorf("%s: expected a parse error at line %d, got %v", test.name, test.line, err)
+		}
+	}
+}
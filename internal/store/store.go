@@ -0,0 +1,167 @@
+// Package store keeps named structure templates in a local directory so they
+// can be reused with `mkproj create --template=<name>`.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// exts are the extensions a template can be stored with, so that its format
+// can be told from its file name. The first one is used for everything else.
+var exts = []string{".txt", ".yaml", ".yml", ".json"}
+
+var (
+	// ErrNotFound is returned when no template has the requested name.
+	ErrNotFound = errors.New("template not found")
+	// ErrExists is returned when adding a template whose name is taken.
+	ErrExists = errors.New("template already exists")
+)
+
+// validName restricts names to something safe to use as a file name.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Store is a directory of templates, one file per template.
+type Store struct {
+	Dir string
+}
+
+// New returns a store backed by dir.
+func New(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// Default returns the store under the user's config directory, honouring
+// $XDG_CONFIG_HOME, e.g. ~/.config/mkproj/templates.
+func Default() (*Store, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		var err error
+		configDir, err = os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return New(filepath.Join(configDir, "mkproj", "templates")), nil
+}
+
+// checkName rejects names that are not safe to use as a file name.
+func checkName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid template name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// storedExt returns the extension a template read from a file with extension
+// ext is stored with.
+func storedExt(ext string) string {
+	ext = strings.ToLower(ext)
+	for _, known := range exts {
+		if ext == known {
+			return ext
+		}
+	}
+	return exts[0]
+}
+
+// Path returns the file the template name is stored in. Its extension tells
+// the format of the template.
+func (s *Store) Path(name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	for _, ext := range exts {
+		path := filepath.Join(s.Dir, name+ext)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Add saves data as the template name, keeping ext, the extension of the
+// file it was read from, when it names a structure format such as ".yaml" or
+// ".json". An existing template is only replaced when overwrite is set.
+func (s *Store) Add(name string, data []byte, ext string, overwrite bool) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	existing, err := s.Path(name)
+	switch {
+	case err == nil && !overwrite:
+		return fmt.Errorf("%w: %s", ErrExists, name)
+	case err != nil && !errors.Is(err, ErrNotFound):
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.Dir, name+storedExt(ext))
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && existing != "" && existing != path {
+		// The template was replaced by one in another format
+		err = os.Remove(existing)
+	}
+	return err
+}
+
+// Get returns the content of the template name.
+func (s *Store) Get(name string) ([]byte, error) {
+	path, err := s.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// List returns the names of all stored templates, sorted.
+func (s *Store) List() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if entry.Type().IsRegular() && storedExt(ext) == ext && validName.MatchString(name) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Remove deletes the template name.
+func (s *Store) Remove(name string) error {
+	path, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
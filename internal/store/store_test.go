@@ -0,0 +1,121 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestStore tests adding, listing, reading and removing templates.
+func TestStore(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "templates"))
+
+	names, err := s.List()
+	if err != nil || len(names) != 0 {
+		t.Fatalf("Expected an empty store, got %v (%v)", names, err)
+	}
+
+	if err := s.Add("go-service", []byte("cmd\n-main.go\n"), "", false); err != nil {
+		t.Fatalf("Unexpected error adding template: %v", err)
+	}
+	if err := s.Add("node-app", []byte("src\n"), "", false); err != nil {
+		t.Fatalf("Unexpected error adding template: %v", err)
+	}
+	if err := s.Add("go-service", []byte("other\n"), "", false); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists when adding a duplicate, got %v", err)
+	}
+	if err := s.Add("go-service", []byte("cmd\n"), "", true); err != nil {
+		t.Errorf("Unexpected error overwriting template: %v", err)
+	}
+
+	names, err = s.List()
+	if err != nil || !reflect.DeepEqual(names, []string{"go-service", "node-app"}) {
+		t.Errorf("List() = %v (%v); want [go-service node-app]", names, err)
+	}
+
+	data, err := s.Get("go-service")
+	if err != nil || string(data) != "cmd\n" {
+		t.Errorf("Get() = %q (%v); want %q", data, err, "cmd\n")
+	}
+
+	if err := s.Remove("node-app"); err != nil {
+		t.Errorf("Unexpected error removing template: %v", err)
+	}
+	if _, err := s.Get("node-app"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after removal, got %v", err)
+	}
+	if err := s.Remove("node-app"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound removing a missing template, got %v", err)
+	}
+}
+
+// TestStore_Extension tests that templates keep the extension of the file
+// they were read from when it names a structure format.
+func TestStore_Extension(t *testing.T) {
+	s := New(t.TempDir())
+	tests := []struct {
+		name, ext, file string
+	}{
+		{"svc", ".yaml", "svc.yaml"},
+		{"api", ".JSON", "api.json"},
+		{"web", ".yml", "web.yml"},
+		{"cli", ".md", "cli.txt"},
+		{"lib", "", "lib.txt"},
+	}
+	for _, test := range tests {
+		if err := s.Add(test.name, []byte("src\n"), test.ext, false); err != nil {
+			t.Errorf("Add(%q, %q) unexpected error: %v", test.name, test.ext, err)
+			continue
+		}
+		if path, err := s.Path(test.name); err != nil || path != filepath.Join(s.Dir, test.file) {
+			t.Errorf("Path(%q) = %q, %v; want %q", test.name, path, err, test.file)
+		}
+	}
+	if err := s.Add("svc", []byte("src\n"), ".json", false); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists when adding a duplicate in another format, got %v", err)
+	}
+
+	// Replacing a template in another format leaves a single file
+	if err := s.Add("svc", []byte("{}\n"), ".json", true); err != nil {
+		t.Fatalf("Unexpected error overwriting template: %v", err)
+	}
+	if path, err := s.Path("svc"); err != nil || path != filepath.Join(s.Dir, "svc.json") {
+		t.Errorf("Path(%q) = %q, %v; want svc.json", "svc", path, err)
+	}
+	names, err := s.List()
+	if err != nil || !reflect.DeepEqual(names, []string{"api", "cli", "lib", "svc", "web"}) {
+		t.Errorf("List() = %v (%v); want [api cli lib svc web]", names, err)
+	}
+	if err := s.Remove("svc"); err != nil {
+		t.Errorf("Unexpected error removing template: %v", err)
+	}
+	if _, err := s.Get("svc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after removal, got %v", err)
+	}
+}
+
+// TestStore_InvalidName tests that names which are not safe file names are rejected.
+func TestStore_InvalidName(t *testing.T) {
+	s := New(t.TempDir())
+
+	for _, name := range []string{"", "../escape", ".hidden", "a/b", "with space"} {
+		if err := s.Add(name, []byte("src\n"), "", false); err == nil {
+			t.Errorf("Expected an error adding template %q", name)
+		}
+	}
+}
+
+// TestDefault tests that the default store lives under XDG_CONFIG_HOME.
+func TestDefault(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+
+	s, err := Default()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := filepath.Join(configDir, "mkproj", "templates"); s.Dir != want {
+		t.Errorf("Default().Dir = %q; want %q", s.Dir, want)
+	}
+}
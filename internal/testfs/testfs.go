@@ -0,0 +1,33 @@
+// Package testfs builds directory trees for the tests of other packages.
+package testfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tree creates the directories and empty files at paths under a temporary
+// root, and returns the root. Paths use forward slashes, and those ending
+// in "/" are directories.
+func Tree(t testing.TB, paths ...string) string {
+	t.Helper()
+	rootDir := t.TempDir()
+	for _, path := range paths {
+		fullPath := filepath.Join(rootDir, filepath.FromSlash(path))
+		if strings.HasSuffix(path, "/") {
+			if err := os.MkdirAll(fullPath, 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, nil, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	return rootDir
+}
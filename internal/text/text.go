@@ -0,0 +1,13 @@
+// Package text holds small helpers for the messages mkproj prints.
+package text
+
+import "fmt"
+
+// Plural formats n followed by the singular or plural noun, as in "1 file"
+// or "3 files".
+func Plural(n int, one, many string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, one)
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
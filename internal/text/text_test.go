@@ -0,0 +1,20 @@
+package text
+
+import "testing"
+
+// TestPlural tests that the noun agrees with the count.
+func TestPlural(t *testing.T) {
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{0, "0 entries"},
+		{1, "1 entry"},
+		{2, "2 entries"},
+	}
+	for _, test := range tests {
+		if got := Plural(test.n, "entry", "entries"); got != test.expected {
+			t.Errorf("Plural(%d) = %q; want %q", test.n, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/spec"
+)
+
+// MaxContentSize is the largest file whose content Capture will inline.
+const MaxContentSize = 1 << 20
+
+// The modes `mkproj create` gives entries without a mode attribute, under the
+// usual umask. Capture only writes the modes that differ from them.
+const (
+	defaultDirMode  fs.FileMode = 0755
+	defaultFileMode fs.FileMode = 0644
+)
+
+// CaptureOptions controls what Capture writes.
+type CaptureOptions struct {
+	ScanOptions
+	// Contents inlines the body of text files as heredoc blocks.
+	Contents bool
+}
+
+// Skipped is an entry, or the content of an entry, that Capture could not
+// represent exactly.
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// Capture writes a structure file to w that recreates rootDir through
+// `mkproj create`, with mode attributes on entries whose permissions differ
+// from the defaults. Entries that the structure format cannot represent, and
+// the contents of files that cannot be inlined verbatim, are left out and
+// returned so the caller can report them.
+func Capture(w io.Writer, rootDir string, opts CaptureOptions) ([]Skipped, error) {
+	scanOpts := opts.ScanOptions
+	scanOpts.Info = true
+	root, err := Scan(rootDir, scanOpts)
+	if err != nil {
+		return nil, err
+	}
+	c := &capturer{w: w, opts: opts}
+	c.entries(root.Children, 0)
+	return c.skipped, c.err
+}
+
+type capturer struct {
+	w       io.Writer
+	opts    CaptureOptions
+	skipped []Skipped
+	err     error
+}
+
+func (c *capturer) entries(entries []*Entry, depth int) {
+	for _, entry := range entries {
+		if c.err != nil {
+			return
+		}
+		if !entry.IsDir() && !entry.IsSymlink() && !entry.Mode.IsRegular() {
+			c.skip(entry.Path, "skipped, not a regular file, directory or symlink")
+			continue
+		}
+		line, ok := formatEntry(entry, depth, spec.Attributes{Mode: capturedMode(entry), Size: -1})
+		if !ok {
+			c.skip(entry.Path, "skipped, name or target cannot be written in the structure format")
+			continue
+		}
+		if entry.IsSymlink() {
+			c.println(line)
+			continue
+		}
+		if entry.IsDir() {
+			c.println(line)
+			c.entries(entry.Children, depth+1)
+			continue
+		}
+		content := c.content(entry)
+		if len(content) == 0 {
+			c.println(line)
+			continue
+		}
+		delimiter := heredocDelimiter(content)
+		c.println(line + " <<" + delimiter)
+		for _, contentLine := range strings.SplitAfter(string(content), "\n") {
+			if contentLine != "" {
+				c.println(render.Escape(strings.TrimSuffix(contentLine, "\n")))
+			}
+		}
+		c.println(delimiter)
+	}
+}
+
+// capturedMode returns the permissions to write for entry, or 0 when create
+// would give it the same ones by default. Windows only has a read-only flag,
+// which is not worth recording.
+func capturedMode(entry *Entry) fs.FileMode {
+	if runtime.GOOS == "windows" {
+		return 0
+	}
+	mode, defaultMode := entry.Mode.Perm(), defaultFileMode
+	if entry.IsDir() {
+		defaultMode = defaultDirMode
+	}
+	if entry.IsSymlink() || mode == defaultMode {
+		return 0
+	}
+	return mode
+}
+
+// content returns the body of a file when it can be inlined exactly, or nil.
+func (c *capturer) content(entry *Entry) []byte {
+	if !c.opts.Contents {
+		return nil
+	}
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		c.err = err
+		return nil
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	if info.Size() > MaxContentSize {
+		c.skip(entry.Path, fmt.Sprintf("content not captured, larger than %d bytes", MaxContentSize))
+		return nil
+	}
+	content, err := os.ReadFile(entry.Path)
+	if err != nil {
+		c.err = err
+		return nil
+	}
+	switch {
+	case !utf8.Valid(content) || bytes.ContainsAny(content, "\x00\r"):
+		c.skip(entry.Path, "content not captured, not plain text")
+		return nil
+	case !bytes.HasSuffix(content, []byte("\n")):
+		c.skip(entry.Path, "content not captured, no trailing newline")
+		return nil
+	}
+	return content
+}
+
+func (c *capturer) skip(path, reason string) {
+	c.skipped = append(c.skipped, Skipped{Path: path, Reason: reason})
+}
+
+func (c *capturer) println(line string) {
+	if c.err == nil {
+		_, c.err = fmt.Fprintln(c.w, line)
+	}
+}
+
+// heredocDelimiter picks a delimiter that no line of content matches.
+func heredocDelimiter(content []byte) string {
+	delimiter := "EOF"
+	for i := 1; ; i++ {
+		clash := false
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.TrimSpace(line) == delimiter {
+				clash = true
+				break
+			}
+		}
+		if !clash {
+			return delimiter
+		}
+		delimiter = fmt.Sprintf("EOF%d", i)
+	}
+}
@@ -0,0 +1,217 @@
+package tree
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/render"
+)
+
+// TestCapture_RoundTrip tests that creating a captured structure recreates the directory.
+func TestCapture_RoundTrip(t *testing.T) {
+	rootDir := t.TempDir()
+	files := map[string]string{
+		"cmd/app/main.go":      "package main\n\nfunc main() {}\n",
+		"README.md":            "# {{.Name}} ${{ secrets.TOKEN }}\nEOF\n",
+		"Makefile":             "",
+		".gitignore":           "bin/\n",
+		".github/CODEOWNERS":   "* @platform\n",
+		"api/v1.2/spec.yaml":   "openapi: 3.0.0\n",
+		"internal/store/empty": "",
+	}
+	for path, content := range files {
+		writeTestFile(t, filepath.Join(rootDir, path), content)
+	}
+	if err := os.MkdirAll(filepath.Join(rootDir, "docs", "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	var out bytes.Buffer
+	skipped, err := Capture(&out, rootDir, CaptureOptions{ScanOptions: ScanOptions{ShowHidden: true}, Contents: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("Expected nothing to be skipped, got %v", skipped)
+	}
+
+	targetDir := filepath.Join(t.TempDir(), "copy")
+	lines, err := render.Lines(strings.Split(out.String(), "\n"), render.Vars{})
+	if err != nil {
+		t.Fatalf("Captured structure does not render: %v\n%s", err, out.String())
+	}
+	if err := project.BuildProjectStructure(lines, targetDir, project.Options{}); err != nil {
+		t.Fatalf("Captured structure does not build: %v\n%s", err, out.String())
+	}
+
+	assertSameTree(t, rootDir, targetDir)
+}
+
+// TestCapture_Skipped tests that entries the format cannot represent are reported.
+func TestCapture_Skipped(t *testing.T) {
+	rootDir := t.TempDir()
+	writeTestFile(t, filepath.Join(rootDir, "binary.dat"), "\x00\x01")
+	writeTestFile(t, filepath.Join(rootDir, "partial.txt"), "no newline")
+	writeTestFile(t, filepath.Join(rootDir, "build", "out.o"), "")
+
+	var out bytes.Buffer
+	skipped, err := Capture(&out, rootDir, CaptureOptions{ScanOptions: ScanOptions{Exclude: []string{"build"}}, Contents: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := out.String(); got != "binary.dat\npartial.txt\n" {
+		t.Errorf("Captured structure = %q; want %q", got, "binary.dat\npartial.txt\n")
+	}
+	if len(skipped) != 2 {
+		t.Errorf("Expected 2 skipped contents, got %v", skipped)
+	}
+}
+
+// TestCapture_Modes tests that permissions other than the defaults are
+// captured and recreated.
+func TestCapture_Modes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	rootDir := t.TempDir()
+	writeTestFile(t, filepath.Join(rootDir, "scripts", "deploy.sh"), "#!/bin/sh\n")
+	writeTestFile(t, filepath.Join(rootDir, "secrets", "token"), "")
+	writeTestFile(t, filepath.Join(rootDir, "README.md"), "")
+	modes := map[string]os.FileMode{
+		"scripts/deploy.sh": 0755,
+		"secrets/token":     0600,
+		"secrets":           0700,
+	}
+	for path, mode := range modes {
+		if err := os.Chmod(filepath.Join(rootDir, path), mode); err != nil {
+			t.Fatalf("Failed to change mode: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := Capture(&out, rootDir, CaptureOptions{Contents: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "README.md\nscripts\n-deploy.sh [mode=0755] <<EOF\n#!/bin/sh\nEOF\nsecrets [mode=0700]\n-token:file [mode=0600]\n"
+	if got := out.String(); got != expected {
+		t.Fatalf("Capture = %q; want %q", got, expected)
+	}
+
+	targetDir := filepath.Join(t.TempDir(), "copy")
+	if err := project.BuildProjectStructure(strings.Split(out.String(), "\n"), targetDir, project.Options{}); err != nil {
+		t.Fatalf("Captured structure does not build: %v\n%s", err, out.String())
+	}
+	for path, want := range modes {
+		info, err := os.Stat(filepath.Join(targetDir, path))
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", path, err)
+			continue
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("Mode of %s = %04o; want %04o", path, got, want)
+		}
+	}
+}
+
+// TestCapture_Symlinks tests that links are captured as links, or as what
+// they point to when followed.
+func TestCapture_Symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	rootDir := t.TempDir()
+	writeTestFile(t, filepath.Join(rootDir, "releases", "v1", "app"), "")
+	symlinkTestFile(t, "releases/v1", filepath.Join(rootDir, "current"))
+	symlinkTestFile(t, "missing", filepath.Join(rootDir, "broken"))
+
+	tests := []struct {
+		follow   bool
+		expected string
+	}{
+		{false, "broken -> missing\ncurrent -> releases/v1\nreleases\n-v1\n--app:file\n"},
+		{true, "broken -> missing\ncurrent\n-app:file\nreleases\n-v1\n--app:file\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		_, err := Capture(&out, rootDir, CaptureOptions{ScanOptions: ScanOptions{FollowSymlinks: test.follow}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := out.String(); got != test.expected {
+			t.Errorf("Capture(follow %v) = %q; want %q", test.follow, got, test.expected)
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := Capture(&out, rootDir, CaptureOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	targetDir := filepath.Join(t.TempDir(), "copy")
+	if err := project.BuildProjectStructure(strings.Split(out.String(), "\n"), targetDir, project.Options{}); err != nil {
+		t.Fatalf("Captured structure does not build: %v\n%s", err, out.String())
+	}
+	assertSameTree(t, rootDir, targetDir)
+}
+
+// symlinkTestFile creates a symlink at path pointing to target.
+func symlinkTestFile(t *testing.T, target, path string) {
+	t.Helper()
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+}
+
+// writeTestFile creates path, and its parent directories, with content.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+// assertSameTree fails the test when the two directories differ in names, kinds or file contents.
+func assertSameTree(t *testing.T, expectedDir, actualDir string) {
+	t.Helper()
+	expected, err := Scan(expectedDir, ScanOptions{ShowHidden: true})
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %v", expectedDir, err)
+	}
+	actual, err := Scan(actualDir, ScanOptions{ShowHidden: true})
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %v", actualDir, err)
+	}
+	compareEntries(t, expected.Children, actual.Children)
+}
+
+func compareEntries(t *testing.T, expected, actual []*Entry) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Errorf("Expected %d entries, got %d", len(expected), len(actual))
+		return
+	}
+	for i := range expected {
+		want, got := expected[i], actual[i]
+		if want.Name != got.Name || want.IsDir() != got.IsDir() || want.Target != got.Target {
+			t.Errorf("Entry %s (dir %v, target %q) was recreated as %s (dir %v, target %q)", want.Path, want.IsDir(), want.Target, got.Path, got.IsDir(), got.Target)
+			continue
+		}
+		if !want.IsDir() && !want.IsSymlink() {
+			wantContent, _ := os.ReadFile(want.Path)
+			gotContent, _ := os.ReadFile(got.Path)
+			if !bytes.Equal(wantContent, gotContent) {
+				t.Errorf("Content of %s = %q; want %q", got.Path, gotContent, wantContent)
+			}
+		}
+		compareEntries(t, want.Children, got.Children)
+	}
+}
@@ -0,0 +1,425 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jobehi/mkproj/internal/spec"
+	"github.com/jobehi/mkproj/internal/text"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an output format of the tree command.
+type Format string
+
+const (
+	// FormatDash is the structure format read by `mkproj create`.
+	FormatDash Format = "dash"
+	// FormatASCII draws branches like `tree --charset=ascii`.
+	FormatASCII Format = "ascii"
+	// FormatJSON is a JSON object of names, with an object for each directory,
+	// null for each file and a "$link" object for each symlink, as read by
+	// `mkproj create --format=json`.
+	FormatJSON Format = "json"
+	// FormatYAML is the YAML equivalent of FormatJSON.
+	FormatYAML Format = "yaml"
+	// FormatMarkdown is a nested bulleted list.
+	FormatMarkdown Format = "markdown"
+	// FormatHTML is a nested <ul> list.
+	FormatHTML Format = "html"
+)
+
+// Formats lists the formats accepted by ParseFormat.
+var Formats = []Format{FormatDash, FormatASCII, FormatJSON, FormatYAML, FormatMarkdown, FormatHTML}
+
+// ParseFormat validates a format name given on the command line.
+func ParseFormat(name string) (Format, error) {
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unknown format %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// MachineReadable reports whether the format is meant for other tools, and
+// so cannot carry a summary footer.
+func (f Format) MachineReadable() bool {
+	return f == FormatJSON || f == FormatYAML
+}
+
+// HasBanner reports whether the format is only meant for reading in a
+// terminal, and so is introduced by a header line. Formats that can be read
+// back by create, pasted into documents or read by other tools are printed
+// bare.
+func (f Format) HasBanner() bool {
+	return f == FormatASCII
+}
+
+// DisplayOptions controls which entries are shown and what is shown about
+// them.
+type DisplayOptions struct {
+	ScanOptions
+	// Size shows the size of files, and the total size of the files below
+	// each directory.
+	Size bool
+	// Perm shows permissions.
+	Perm bool
+	// ModTime shows modification times.
+	ModTime bool
+	// Summary ends the output with an "N directories, M files" line. It is
+	// not available in the machine-readable formats.
+	Summary bool
+}
+
+// Display writes rootDir to w in format, preceded by a header line when the
+// format has one.
+func Display(w io.Writer, rootDir string, format Format, opts DisplayOptions) error {
+	if format.HasBanner() {
+		if _, err := fmt.Fprintln(w, "Current Directory Structure:"); err != nil {
+			return err
+		}
+	}
+	return Write(w, rootDir, format, opts)
+}
+
+// Write writes rootDir to w in format. In the ascii and document formats,
+// the metadata chosen in opts is shown in brackets before each name. In json
+// and yaml it is added as "$size", "$mode" and "$mtime" attributes, and the
+// dash format writes it as a trailing "[mode=... size=... mtime=...]" block;
+// create reads both back.
+func Write(w io.Writer, rootDir string, format Format, opts DisplayOptions) error {
+	if opts.Summary && format.MachineReadable() {
+		return fmt.Errorf("the %s format has no summary", format)
+	}
+	scanOpts := opts.ScanOptions
+	scanOpts.Sizes = scanOpts.Sizes || opts.Size
+	scanOpts.Info = scanOpts.Info || opts.Perm || opts.ModTime
+	root, err := Scan(rootDir, scanOpts)
+	if root == nil {
+		return err
+	}
+	p := &printer{w: w, opts: opts}
+	switch format {
+	case FormatDash:
+		p.dash(root.Children, 0)
+	case FormatASCII:
+		p.println(rootDir)
+		p.ascii(root.Children, "")
+	case FormatJSON:
+		p.jsonObject(nil, root.Children, "")
+		p.println("")
+	case FormatYAML:
+		p.yaml(root)
+	case FormatMarkdown:
+		p.markdown(root.Children, "")
+	case FormatHTML:
+		p.html(root.Children, "")
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	if opts.Summary {
+		p.summary(root, format)
+	}
+	if err == nil {
+		err = p.err
+	}
+	return err
+}
+
+// printer writes to w until the first error, which it keeps.
+type printer struct {
+	w    io.Writer
+	opts DisplayOptions
+	err  error
+}
+
+func (p *printer) print(s string) {
+	if p.err == nil {
+		_, p.err = io.WriteString(p.w, s)
+	}
+}
+
+func (p *printer) println(s string) {
+	p.print(s + "\n")
+}
+
+// displayName adds a trailing slash to directory names, and the target to
+// symlinks.
+func displayName(entry *Entry) string {
+	if entry.Target != "" {
+		return entry.Name + " -> " + entry.Target
+	}
+	if entry.IsDir() {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// columns returns the bracketed metadata shown before the name of entry, or
+// "" when no metadata was asked for.
+func (p *printer) columns(entry *Entry) string {
+	var fields []string
+	if p.opts.Perm {
+		fields = append(fields, permColumn(entry))
+	}
+	if p.opts.Size {
+		fields = append(fields, fmt.Sprintf("%5s", humanSize(entry.Size)))
+	}
+	if p.opts.ModTime {
+		fields = append(fields, entry.ModTime.Format("2006-01-02 15:04"))
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(fields, "  ") + "]  "
+}
+
+// permColumn returns the permissions of entry, or blanks for a symlink,
+// whose own permission bits mean nothing.
+func permColumn(entry *Entry) string {
+	perm := entry.Mode.String()
+	if entry.IsSymlink() {
+		return strings.Repeat(" ", len(perm))
+	}
+	return perm
+}
+
+// humanSize writes size in bytes with a binary unit suffix, like "512",
+// "1.5K" or "20M".
+func humanSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprint(size)
+	}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len("KMGTPE") {
+		value /= 1024
+		unit++
+	}
+	suffix := "KMGTPE"[unit-1 : unit]
+	if value < 10 {
+		return fmt.Sprintf("%.1f%s", value, suffix)
+	}
+	return fmt.Sprintf("%.0f%s", value, suffix)
+}
+
+// summary writes the "N directories, M files" footer.
+func (p *printer) summary(root *Entry, format Format) {
+	dirs, files := 0, 0
+	walkEntries(root.Children, 0, func(entry *Entry, depth int) {
+		if entry.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+	})
+	line := text.Plural(dirs, "directory", "directories") + ", " + text.Plural(files, "file", "files")
+	if format == FormatHTML {
+		p.println("<p>" + line + "</p>")
+		return
+	}
+	p.println("")
+	p.println(line)
+}
+
+// dash writes the structure format. Metadata is written as attributes after
+// the name rather than in columns, so the output still builds.
+func (p *printer) dash(entries []*Entry, depth int) {
+	for _, entry := range entries {
+		attrs := spec.Attributes{Size: -1}
+		if p.opts.Perm {
+			attrs.Mode = entry.Mode.Perm()
+		}
+		if p.opts.Size {
+			attrs.Size = entry.Size
+		}
+		if p.opts.ModTime {
+			attrs.ModTime = entry.ModTime
+		}
+		line, ok := formatEntry(entry, depth, attrs)
+		if !ok && p.err == nil {
+			p.err = fmt.Errorf("%s: name or target cannot be written in the structure format", entry.Path)
+		}
+		p.println(line)
+		p.dash(entry.Children, depth+1)
+	}
+}
+
+func (p *printer) ascii(entries []*Entry, prefix string) {
+	for i, entry := range entries {
+		connector, indent := "|-- ", "|   "
+		if i == len(entries)-1 {
+			connector, indent = "`-- ", "    "
+		}
+		p.println(prefix + connector + p.columns(entry) + displayName(entry))
+		p.ascii(entry.Children, prefix+indent)
+	}
+}
+
+// jsonObject writes an object holding the attributes of an entry followed
+// by its children, one member per line.
+func (p *printer) jsonObject(attributes []attribute, children []*Entry, indent string) {
+	count := len(attributes) + len(children)
+	if count == 0 {
+		p.print("{}")
+		return
+	}
+	p.println("{")
+	written := 0
+	endMember := func() {
+		if written++; written < count {
+			p.print(",")
+		}
+		p.println("")
+	}
+	for _, attr := range attributes {
+		p.print(indent + "  " + jsonString(attr.key) + ": " + attr.json)
+		endMember()
+	}
+	for _, entry := range children {
+		attributes := p.attributes(entry)
+		p.print(indent + "  " + jsonString(documentKey(entry, attributes)) + ": ")
+		if entry.IsDir() || len(attributes) > 0 {
+			p.jsonObject(attributes, entry.Children, indent+"  ")
+		} else {
+			p.print("null")
+		}
+		endMember()
+	}
+	p.print(indent + "}")
+}
+
+// attribute is a piece of metadata written as a "$" key in json and yaml.
+type attribute struct {
+	key  string
+	json string
+	yaml *yaml.Node
+}
+
+// attributes returns the target of a symlink entry and the metadata chosen
+// in the options. Symlinks have no mode of their own.
+func (p *printer) attributes(entry *Entry) []attribute {
+	var attributes []attribute
+	if entry.IsSymlink() {
+		attributes = append(attributes, attribute{"$link", jsonString(entry.Target), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: entry.Target}})
+	}
+	if p.opts.Perm && !entry.IsSymlink() {
+		mode := fmt.Sprintf("%04o", uint32(entry.Mode.Perm()))
+		attributes = append(attributes, attribute{"$mode", jsonString(mode), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: mode}})
+	}
+	if p.opts.Size {
+		size := fmt.Sprint(entry.Size)
+		attributes = append(attributes, attribute{"$size", size, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: size}})
+	}
+	if p.opts.ModTime {
+		mtime := entry.ModTime.Format(time.RFC3339)
+		attributes = append(attributes, attribute{"$mtime", jsonString(mtime), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: mtime}})
+	}
+	return attributes
+}
+
+// documentKey returns the name of entry as a json or yaml key. A directory
+// shown without children but with attributes gets a trailing slash, as create
+// reads such a mapping as a file otherwise.
+func documentKey(entry *Entry, attributes []attribute) string {
+	if entry.IsDir() && len(entry.Children) == 0 && len(attributes) > 0 {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// jsonString quotes s as a JSON string, leaving HTML characters as they are.
+func jsonString(s string) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s) // cannot fail for a string
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (p *printer) yaml(root *Entry) {
+	if p.err != nil {
+		return
+	}
+	encoder := yaml.NewEncoder(p.w)
+	encoder.SetIndent(2)
+	node := p.yamlNode(root)
+	if len(node.Content) == 0 {
+		node.Style = yaml.FlowStyle
+	}
+	if p.err = encoder.Encode(node); p.err == nil {
+		p.err = encoder.Close()
+	}
+}
+
+// yamlNode converts a directory into a mapping node, with a nested mapping
+// for each subdirectory and null for each file, or a mapping of its
+// attributes when it has some.
+func (p *printer) yamlNode(dir *Entry) *yaml.Node {
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	for _, entry := range dir.Children {
+		attributes := p.attributes(entry)
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: documentKey(entry, attributes)}
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+		if entry.IsDir() {
+			value = p.yamlNode(entry)
+		} else if len(attributes) > 0 {
+			value = &yaml.Node{Kind: yaml.MappingNode}
+		}
+		if len(attributes) > 0 {
+			var content []*yaml.Node
+			for _, attr := range attributes {
+				content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: attr.key}, attr.yaml)
+			}
+			value.Content = append(content, value.Content...)
+		}
+		if value.Kind == yaml.MappingNode && len(value.Content) == 0 {
+			value.Style = yaml.FlowStyle
+		}
+		mapping.Content = append(mapping.Content, key, value)
+	}
+	return mapping
+}
+
+func (p *printer) markdown(entries []*Entry, indent string) {
+	for _, entry := range entries {
+		p.println(indent + "- " + p.columns(entry) + codeSpan(displayName(entry)))
+		p.markdown(entry.Children, indent+"  ")
+	}
+}
+
+// codeSpan wraps s in a Markdown code span, using a longer fence when s
+// contains backticks.
+func codeSpan(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if fence != "`" {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+func (p *printer) html(entries []*Entry, indent string) {
+	p.println(indent + "<ul>")
+	for _, entry := range entries {
+		name := html.EscapeString(p.columns(entry) + displayName(entry))
+		if len(entry.Children) == 0 {
+			p.println(indent + "  <li>" + name + "</li>")
+			continue
+		}
+		p.println(indent + "  <li>" + name)
+		p.html(entry.Children, indent+"    ")
+		p.println(indent + "  </li>")
+	}
+	p.println(indent + "</ul>")
+}
@@ -0,0 +1,374 @@
+package tree
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/spec"
+)
+
+// setupFormatTree creates the directory used by the format tests.
+func setupFormatTree(t *testing.T) string {
+	t.Helper()
+	rootDir := t.TempDir()
+	writeTestFile(t, filepath.Join(rootDir, "src", "main.go"), "")
+	writeTestFile(t, filepath.Join(rootDir, "src", "v1.2", "a&b.txt"), "")
+	writeTestFile(t, filepath.Join(rootDir, "true"), "")
+	if err := os.Mkdir(filepath.Join(rootDir, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	return rootDir
+}
+
+// TestWrite tests the output of every format.
+func TestWrite(t *testing.T) {
+	rootDir := setupFormatTree(t)
+	tests := map[Format]string{
+		FormatDash: "empty\nsrc\n-main.go\n-v1.2/\n--a&b.txt\ntrue:file\n",
+		FormatASCII: rootDir + "\n" +
+			"|-- empty/\n" +
+			"|-- src/\n" +
+			"|   |-- main.go\n" +
+			"|   `-- v1.2/\n" +
+			"|       `-- a&b.txt\n" +
+			"`-- true\n",
+		FormatJSON: "{\n" +
+			"  \"empty\": {},\n" +
+			"  \"src\": {\n" +
+			"    \"main.go\": null,\n" +
+			"    \"v1.2\": {\n" +
+			"      \"a&b.txt\": null\n" +
+			"    }\n" +
+			"  },\n" +
+			"  \"true\": null\n" +
+			"}\n",
+		FormatYAML: "empty: {}\n" +
+			"src:\n" +
+			"  main.go: null\n" +
+			"  v1.2:\n" +
+			"    a&b.txt: null\n" +
+			"\"true\": null\n",
+		FormatMarkdown: "- `empty/`\n" +
+			"- `src/`\n" +
+			"  - `main.go`\n" +
+			"  - `v1.2/`\n" +
+			"    - `a&b.txt`\n" +
+			"- `true`\n",
+		FormatHTML: "<ul>\n" +
+			"  <li>empty/</li>\n" +
+			"  <li>src/\n" +
+			"    <ul>\n" +
+			"      <li>main.go</li>\n" +
+			"      <li>v1.2/\n" +
+			"        <ul>\n" +
+			"          <li>a&amp;b.txt</li>\n" +
+			"        </ul>\n" +
+			"      </li>\n" +
+			"    </ul>\n" +
+			"  </li>\n" +
+			"  <li>true</li>\n" +
+			"</ul>\n",
+	}
+
+	for _, format := range Formats {
+		var out bytes.Buffer
+		if err := Write(&out, rootDir, format, DisplayOptions{}); err != nil {
+			t.Errorf("Write(%s) unexpected error: %v", format, err)
+			continue
+		}
+		if out.String() != tests[format] {
+			t.Errorf("Write(%s) =\n%s\nwant:\n%s", format, out.String(), tests[format])
+		}
+	}
+}
+
+// TestWrite_EmptyDirectory tests that every format handles a directory without entries.
+func TestWrite_EmptyDirectory(t *testing.T) {
+	rootDir := t.TempDir()
+	tests := map[Format]string{
+		FormatDash:     "",
+		FormatASCII:    rootDir + "\n",
+		FormatJSON:     "{}\n",
+		FormatYAML:     "{}\n",
+		FormatMarkdown: "",
+		FormatHTML:     "<ul>\n</ul>\n",
+	}
+	for format, expected := range tests {
+		var out bytes.Buffer
+		if err := Write(&out, rootDir, format, DisplayOptions{}); err != nil || out.String() != expected {
+			t.Errorf("Write(%s) = %q, %v; want %q", format, out.String(), err, expected)
+		}
+	}
+}
+
+// TestDisplay_Banner tests that only the ascii format prints a header line.
+func TestDisplay_Banner(t *testing.T) {
+	rootDir := setupFormatTree(t)
+	for _, format := range Formats {
+		var out bytes.Buffer
+		if err := Display(&out, rootDir, format, DisplayOptions{}); err != nil {
+			t.Errorf("Display(%s) unexpected error: %v", format, err)
+			continue
+		}
+		hasBanner := strings.HasPrefix(out.String(), "Current Directory Structure:\n")
+		if hasBanner != (format == FormatASCII) {
+			t.Errorf("Display(%s) printed a banner: %t; want %t", format, hasBanner, format == FormatASCII)
+		}
+	}
+}
+
+// TestWrite_RoundTrip tests that the JSON and YAML output recreate the
+// directory, with its modes when they are written.
+func TestWrite_RoundTrip(t *testing.T) {
+	rootDir := setupFormatTree(t)
+	if runtime.GOOS != "windows" {
+		for path, mode := range map[string]os.FileMode{"src/main.go": 0600, "empty": 0700} {
+			if err := os.Chmod(filepath.Join(rootDir, path), mode); err != nil {
+				t.Fatalf("Failed to change mode: %v", err)
+			}
+		}
+	}
+	formats := map[Format]spec.Format{FormatJSON: spec.FormatJSON, FormatYAML: spec.FormatYAML}
+	for format, inputFormat := range formats {
+		for _, opts := range []DisplayOptions{{}, {Perm: true, Size: true, ModTime: true}} {
+			var out bytes.Buffer
+			if err := Write(&out, rootDir, format, opts); err != nil {
+				t.Fatalf("Write(%s) unexpected error: %v", format, err)
+			}
+			targetDir := filepath.Join(t.TempDir(), "copy")
+			lines := strings.Split(out.String(), "\n")
+			if err := project.BuildProjectStructure(lines, targetDir, project.Options{Format: inputFormat}); err != nil {
+				t.Fatalf("%s output does not build: %v\n%s", format, err, out.String())
+			}
+			assertSameTree(t, rootDir, targetDir)
+			if opts.Perm && runtime.GOOS != "windows" {
+				assertSameModes(t, rootDir, targetDir)
+			}
+		}
+	}
+}
+
+// assertSameModes checks that every entry of want has the same permission
+// bits in got.
+func assertSameModes(t *testing.T, want, got string) {
+	t.Helper()
+	wantRoot, err := Scan(want, ScanOptions{Info: true})
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %v", want, err)
+	}
+	walkEntries(wantRoot.Children, 0, func(entry *Entry, depth int) {
+		rel, _ := filepath.Rel(want, entry.Path)
+		info, err := os.Lstat(filepath.Join(got, rel))
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", rel, err)
+		} else if info.Mode() != entry.Mode {
+			t.Errorf("Mode of %s = %v; want %v", rel, info.Mode(), entry.Mode)
+		}
+	})
+}
+
+// TestParseFormat tests format name validation.
+func TestParseFormat(t *testing.T) {
+	for _, format := range Formats {
+		if parsed, err := ParseFormat(string(format)); err != nil || parsed != format {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", format, parsed, err, format)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("ParseFormat(%q) expected an error", "xml")
+	}
+}
+
+// TestWrite_Metadata tests the size, permission and modification time columns and attributes.
+func TestWrite_Metadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	rootDir := t.TempDir()
+	writeTestFile(t, filepath.Join(rootDir, "src", "deep", "main.go"), "package main\n")
+	writeTestFile(t, filepath.Join(rootDir, "run.sh"), strings.Repeat("#", 2048))
+	mtime := time.Date(2024, 10, 13, 9, 30, 0, 0, time.Local)
+	for _, path := range []string{"src/deep/main.go", "src/deep", "src", "run.sh"} {
+		fullPath := filepath.Join(rootDir, path)
+		mode := os.FileMode(0755)
+		if path == "src/deep/main.go" {
+			mode = 0644
+		}
+		if err := os.Chmod(fullPath, mode); err != nil {
+			t.Fatalf("Failed to change mode: %v", err)
+		}
+		if err := os.Chtimes(fullPath, mtime, mtime); err != nil {
+			t.Fatalf("Failed to change times: %v", err)
+		}
+	}
+
+	tests := []struct {
+		format   Format
+		opts     DisplayOptions
+		expected string
+	}{
+		{
+			FormatASCII,
+			DisplayOptions{Size: true, Perm: true, ModTime: true},
+			rootDir + "\n" +
+				"|-- [-rwxr-xr-x   2.0K  2024-10-13 09:30]  run.sh\n" +
+				"`-- [drwxr-xr-x     13  2024-10-13 09:30]  src/\n" +
+				"    `-- [drwxr-xr-x     13  2024-10-13 09:30]  deep/\n" +
+				"        `-- [-rw-r--r--     13  2024-10-13 09:30]  main.go\n",
+		},
+		{
+			// Sizes count the files below the depth limit
+			FormatDash,
+			DisplayOptions{ScanOptions: ScanOptions{MaxDepth: 1}, Size: true, Summary: true},
+			"run.sh [size=2048]\n" +
+				"src [size=13]\n" +
+				"\n" +
+				"1 directory, 1 file\n",
+		},
+		{
+			// Metadata becomes attributes that create reads back
+			FormatDash,
+			DisplayOptions{Size: true, Perm: true, ModTime: true},
+			"run.sh [mode=0755 size=2048 mtime=" + mtime.Format(time.RFC3339) + "]\n" +
+				"src [mode=0755 size=13 mtime=" + mtime.Format(time.RFC3339) + "]\n" +
+				"-deep [mode=0755 size=13 mtime=" + mtime.Format(time.RFC3339) + "]\n" +
+				"--main.go [mode=0644 size=13 mtime=" + mtime.Format(time.RFC3339) + "]\n",
+		},
+		{
+			FormatJSON,
+			DisplayOptions{ScanOptions: ScanOptions{Patterns: []string{"*.go"}}, Size: true, Perm: true},
+			"{\n" +
+				"  \"src\": {\n" +
+				"    \"$mode\": \"0755\",\n" +
+				"    \"$size\": 13,\n" +
+				"    \"deep\": {\n" +
+				"      \"$mode\": \"0755\",\n" +
+				"      \"$size\": 13,\n" +
+				"      \"main.go\": {\n" +
+				"        \"$mode\": \"0644\",\n" +
+				"        \"$size\": 13\n" +
+				"      }\n" +
+				"    }\n" +
+				"  }\n" +
+				"}\n",
+		},
+		{
+			FormatYAML,
+			DisplayOptions{ScanOptions: ScanOptions{MaxDepth: 1}, ModTime: true},
+			"run.sh:\n" +
+				"  $mtime: \"" + mtime.Format(time.RFC3339) + "\"\n" +
+				"src/:\n" +
+				"  $mtime: \"" + mtime.Format(time.RFC3339) + "\"\n",
+		},
+		{
+			FormatMarkdown,
+			DisplayOptions{Summary: true},
+			"- `run.sh`\n" +
+				"- `src/`\n" +
+				"  - `deep/`\n" +
+				"    - `main.go`\n" +
+				"\n" +
+				"2 directories, 2 files\n",
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := Write(&out, rootDir, test.format, test.opts); err != nil {
+			t.Errorf("Write(%s) unexpected error: %v", test.format, err)
+			continue
+		}
+		if out.String() != test.expected {
+			t.Errorf("Write(%s) =\n%s\nwant:\n%s", test.format, out.String(), test.expected)
+		}
+		if test.format == FormatDash && !test.opts.Summary {
+			if _, err := spec.Parse(strings.Split(out.String(), "\n")); err != nil {
+				t.Errorf("Parse(Write(dash)) unexpected error: %v", err)
+			}
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, rootDir, FormatJSON, DisplayOptions{Summary: true}); err == nil {
+		t.Errorf("Write(json) with a summary expected an error")
+	}
+}
+
+// permPattern matches a mode attribute or a permission column.
+var permPattern = regexp.MustCompile(`mode|[-dL][r-][w-][x-][r-][w-][x-]`)
+
+// TestWrite_Symlinks tests that links are printed with their targets.
+func TestWrite_Symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	rootDir := t.TempDir()
+	writeTestFile(t, filepath.Join(rootDir, "v1", "app"), "")
+	symlinkTestFile(t, "v1", filepath.Join(rootDir, "current"))
+
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{FormatDash, "current -> v1\nv1\n-app:file\n"},
+		{FormatASCII, rootDir + "\n|-- current -> v1\n`-- v1/\n    `-- app\n"},
+		{FormatJSON, "{\n  \"current\": {\n    \"$link\": \"v1\"\n  },\n  \"v1\": {\n    \"app\": null\n  }\n}\n"},
+		{FormatYAML, "current:\n  $link: v1\nv1:\n  app: null\n"},
+		{FormatMarkdown, "- `current -> v1`\n- `v1/`\n  - `app`\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := Write(&out, rootDir, test.format, DisplayOptions{}); err != nil {
+			t.Fatalf("Write(%s) unexpected error: %v", test.format, err)
+		}
+		if got := out.String(); got != test.expected {
+			t.Errorf("Write(%s) = %q; want %q", test.format, got, test.expected)
+		}
+	}
+
+	// Symlinks have no mode of their own in any format
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := Write(&out, rootDir, test.format, DisplayOptions{Perm: true}); err != nil {
+			t.Fatalf("Write(%s) unexpected error: %v", test.format, err)
+		}
+		if modes := permPattern.FindAllString(out.String(), -1); len(modes) != 2 {
+			t.Errorf("Write(%s) with permissions gave the symlink a mode:\n%s", test.format, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Write(&out, rootDir, FormatASCII, DisplayOptions{ScanOptions: ScanOptions{FollowSymlinks: true}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := rootDir + "\n|-- current -> v1\n|   `-- app\n`-- v1/\n    `-- app\n"; out.String() != expected {
+		t.Errorf("Write(ascii, follow) = %q; want %q", out.String(), expected)
+	}
+}
+
+// TestHumanSize tests size formatting.
+func TestHumanSize(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0",
+		1023:            "1023",
+		1024:            "1.0K",
+		1536:            "1.5K",
+		10 * 1024:       "10K",
+		1023 * 1024:     "1023K",
+		5 * 1024 * 1024: "5.0M",
+		3 << 30:         "3.0G",
+		int64(1) << 62:  "4.0E",
+	}
+	for size, expected := range tests {
+		if got := humanSize(size); got != expected {
+			t.Errorf("humanSize(%d) = %q; want %q", size, got, expected)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package tree
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/jobehi/mkproj/internal/project"
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/spec"
+)
+
+// nameAlphabet favours the characters that are syntax in the structure format.
+const nameAlphabet = "abc.-_: <->[]\\{}\té"
+
+// nameTokens are the sequences with a meaning in the structure format, such
+// as symlink arrows and attribute blocks, that random characters rarely form.
+var nameTokens = []string{"->", " -> ", " [", " [mode=0755]", "]", "<<"}
+
+// genNode is a randomly generated file or directory.
+type genNode struct {
+	name     string
+	dir      bool
+	children []*genNode
+}
+
+// genTree is a random directory tree used as input for property tests.
+type genTree struct {
+	children []*genNode
+}
+
+// Generate implements quick.Generator.
+func (genTree) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(genTree{children: genChildren(r, 3)})
+}
+
+func genChildren(r *rand.Rand, depth int) []*genNode {
+	var children []*genNode
+	seen := map[string]bool{}
+	for i := r.Intn(5); i > 0; i-- {
+		name := genName(r)
+		if seen[name] || !spec.CanFormat(name) {
+			continue
+		}
+		seen[name] = true
+		node := &genNode{name: name, dir: depth > 0 && r.Intn(2) == 0}
+		if node.dir {
+			node.children = genChildren(r, depth-1)
+		}
+		children = append(children, node)
+	}
+	return children
+}
+
+func genName(r *rand.Rand) string {
+	alphabet := []rune(nameAlphabet)
+	var b strings.Builder
+	for i := r.Intn(6) + 1; i > 0; i-- {
+		if r.Intn(4) == 0 {
+			b.WriteString(nameTokens[r.Intn(len(nameTokens))])
+			continue
+		}
+		b.WriteRune(alphabet[r.Intn(len(alphabet))])
+	}
+	return b.String()
+}
+
+// materialize creates the generated tree under dir.
+func materialize(dir string, nodes []*genNode) error {
+	for _, node := range nodes {
+		path := filepath.Join(dir, node.name)
+		if !node.dir {
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Mkdir(path, 0755); err != nil {
+			return err
+		}
+		if err := materialize(path, node.children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameEntries reports whether two scanned trees have the same names and kinds.
+func sameEntries(a, b []*Entry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].IsDir() != b[i].IsDir() || !sameEntries(a[i].Children, b[i].Children) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestRoundTrip_Property checks that create(tree(x)) == x for random trees,
+// using the output `mkproj tree` prints.
+func TestRoundTrip_Property(t *testing.T) {
+	property := func(x genTree) bool {
+		sourceDir := t.TempDir()
+		if err := materialize(sourceDir, x.children); err != nil {
+			t.Fatalf("Failed to materialize tree: %v", err)
+		}
+
+		var out bytes.Buffer
+		opts := DisplayOptions{ScanOptions: ScanOptions{ShowHidden: true}}
+		if err := Display(&out, sourceDir, FormatDash, opts); err != nil {
+			t.Logf("Display failed: %v", err)
+			return false
+		}
+		lines, err := render.Lines(strings.Split(out.String(), "\n"), render.Vars{})
+		if err != nil {
+			t.Logf("Rendering failed: %v\n%s", err, out.String())
+			return false
+		}
+		targetDir := filepath.Join(t.TempDir(), "copy")
+		if err := project.BuildProjectStructure(lines, targetDir, project.Options{}); err != nil {
+			t.Logf("Building failed: %v\n%s", err, out.String())
+			return false
+		}
+
+		source, err := Scan(sourceDir, ScanOptions{ShowHidden: true})
+		if err != nil {
+			t.Fatalf("Failed to scan source: %v", err)
+		}
+		target, err := Scan(targetDir, ScanOptions{ShowHidden: true})
+		if err != nil {
+			t.Fatalf("Failed to scan target: %v", err)
+		}
+		if !sameEntries(source.Children, target.Children) {
+			t.Logf("Trees differ for structure:\n%s", out.String())
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
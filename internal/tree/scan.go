@@ -0,0 +1,365 @@
+package tree
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jobehi/mkproj/internal/ignore"
+)
+
+// Entry is a file or directory found while scanning a tree. The Size of a
+// directory is the total size of the files found below it. Mode only holds
+// the type bits, and Size and ModTime are zero, unless ScanOptions.Info is
+// set. Target is set for symlinks, including followed ones, whose Mode is
+// that of the entry they point to.
+type Entry struct {
+	Name     string
+	Path     string
+	Mode     os.FileMode
+	Size     int64
+	ModTime  time.Time
+	Target   string
+	Children []*Entry
+}
+
+// newEntry makes the entry for a file or directory at path.
+func newEntry(path string, info fs.FileInfo) *Entry {
+	entry := &Entry{Name: info.Name(), Path: path, Mode: info.Mode(), ModTime: info.ModTime()}
+	if !info.IsDir() {
+		entry.Size = info.Size()
+	}
+	return entry
+}
+
+// IsDir reports whether the entry is a directory.
+func (e *Entry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// IsSymlink reports whether the entry is a symlink that was not followed.
+func (e *Entry) IsSymlink() bool {
+	return e.Mode&fs.ModeSymlink != 0
+}
+
+// ScanOptions controls which entries Scan keeps.
+type ScanOptions struct {
+	// ShowHidden keeps files and directories whose name starts with a dot.
+	ShowHidden bool
+	// Ignore leaves out .git directories and entries matched by the
+	// .gitignore and .mkprojignore files found at any level of the tree, and
+	// by .git/info/exclude at the root.
+	Ignore bool
+	// Exclude holds glob patterns; an entry is skipped when its name or its
+	// slash-separated path relative to the root matches one of them.
+	Exclude []string
+	// Include holds glob patterns matched like Exclude. A matching entry is
+	// kept even when it is hidden, excluded or ignored.
+	Include []string
+	// Patterns, when set, keeps only the files whose name matches one of these
+	// globs. Directories are not filtered.
+	Patterns []string
+	// MaxDepth stops the walk at this many levels below the root; 0 means no
+	// limit. Directories at the limit are listed but not read.
+	MaxDepth int
+	// DirsOnly leaves out everything but directories.
+	DirsOnly bool
+	// Prune removes directories left without entries once the others have
+	// been filtered. Directories at MaxDepth are kept, as their content is not
+	// known.
+	Prune bool
+	// Info fills in the full mode, size and modification time of entries,
+	// at the cost of an lstat for each one.
+	Info bool
+	// Sizes walks past MaxDepth, without listing anything, so that the sizes
+	// of directories at the limit count everything below them. It implies
+	// Info.
+	Sizes bool
+	// FollowSymlinks lists what symlinks point to as if it were in their
+	// place. Links that are broken, or that lead back to a directory they
+	// are in, are kept as links.
+	FollowSymlinks bool
+	// Workers bounds the number of directories read at the same time; 0
+	// picks a default based on the number of CPUs.
+	Workers int
+}
+
+// Scan walks rootDir and returns it as a tree of entries. Children are sorted
+// by name, whatever order the directories were read in. Directories are read
+// concurrently; when some cannot be read, Scan returns everything else along
+// with the first error in walk order.
+func Scan(rootDir string, opts ScanOptions) (*Entry, error) {
+	stat := os.Lstat
+	if opts.FollowSymlinks {
+		stat = os.Stat
+	}
+	info, err := stat(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	root := newEntry(rootDir, info)
+	if !info.IsDir() {
+		return root, nil
+	}
+	var matcher *ignore.Matcher
+	if opts.Ignore {
+		patterns, err := ignore.ReadFile(filepath.Join(rootDir, ".git", "info", "exclude"))
+		if err != nil {
+			return nil, err
+		}
+		if matcher, err = matcher.With("", patterns).LoadDir(rootDir, ""); err != nil {
+			return nil, err
+		}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4 * runtime.GOMAXPROCS(0)
+	}
+	s := &scanner{opts: opts, slots: make(chan struct{}, workers)}
+	s.opts.Info = opts.Info || opts.Sizes
+	s.dir(root, "", 0, matcher, nil, []string{rootDir})
+	s.wg.Wait()
+	if opts.Prune {
+		prune(root, 0, opts.MaxDepth)
+	}
+	addSizes(root)
+	return root, s.firstError()
+}
+
+// scanner reads the directories of one Scan, several at a time.
+type scanner struct {
+	opts  ScanOptions
+	slots chan struct{} // one per directory being read in its own goroutine
+	wg    sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []pathError
+}
+
+// pathError is a failure to read the entry at a root-relative path.
+type pathError struct {
+	relativePath string
+	err          error
+}
+
+// dir reads the directory of entry, at relativePath and depth, and scans its
+// subdirectories, each in a new goroutine while a worker slot is free and
+// inline otherwise. When counted is set, the directory lies below the depth
+// limit: nothing is listed and the sizes of its files are added to counted.
+// ancestors holds the paths of the directories walked through to reach
+// entry, itself included, so that followed symlinks cannot loop.
+func (s *scanner) dir(entry *Entry, relativePath string, depth int, matcher *ignore.Matcher, counted *sizeCounter, ancestors []string) {
+	dirEntries, err := os.ReadDir(entry.Path)
+	if err != nil {
+		s.fail(relativePath, err)
+	}
+	type subdir struct {
+		entry        *Entry
+		relativePath string
+		counted      *sizeCounter
+	}
+	var subdirs []subdir
+	for _, d := range dirEntries {
+		childPath := filepath.Join(relativePath, d.Name())
+		path := filepath.Join(entry.Path, d.Name())
+		var target string
+		var info fs.FileInfo // of the link target, when followed
+		if d.Type()&fs.ModeSymlink != 0 {
+			if target, err = os.Readlink(path); err != nil {
+				s.fail(childPath, err)
+				continue
+			}
+			if s.opts.FollowSymlinks {
+				info = follow(path, ancestors)
+			}
+			if info != nil {
+				d = fs.FileInfoToDirEntry(info)
+			}
+		}
+		if s.opts.skip(childPath, d, matcher) {
+			continue
+		}
+		child := &Entry{Name: d.Name(), Path: path, Mode: d.Type(), Target: target}
+		if s.opts.Info {
+			if info == nil {
+				if info, err = d.Info(); err != nil {
+					s.fail(childPath, err)
+					continue
+				}
+			}
+			child = newEntry(path, info)
+			child.Target = target
+		}
+		if counted != nil {
+			counted.add(child.Size)
+		} else {
+			entry.Children = append(entry.Children, child)
+		}
+		if !child.IsDir() {
+			continue
+		}
+		childCounted := counted
+		if childCounted == nil && s.opts.MaxDepth > 0 && depth+1 >= s.opts.MaxDepth {
+			if !s.opts.Sizes {
+				continue
+			}
+			childCounted = &sizeCounter{entry: child}
+		}
+		subdirs = append(subdirs, subdir{child, childPath, childCounted})
+	}
+	for _, sub := range subdirs {
+		childAncestors := ancestors[:len(ancestors):len(ancestors)]
+		if s.opts.FollowSymlinks {
+			childAncestors = append(childAncestors, sub.entry.Path)
+		}
+		childMatcher := matcher
+		if s.opts.Ignore {
+			childMatcher, err = matcher.LoadDir(sub.entry.Path, filepath.ToSlash(sub.relativePath))
+			if err != nil {
+				s.fail(sub.relativePath, err)
+			}
+		}
+		select {
+		case s.slots <- struct{}{}:
+			s.wg.Add(1)
+			go func(sub subdir, matcher *ignore.Matcher, ancestors []string) {
+				defer func() {
+					<-s.slots
+					s.wg.Done()
+				}()
+				s.dir(sub.entry, sub.relativePath, depth+1, matcher, sub.counted, ancestors)
+			}(sub, childMatcher, childAncestors)
+		default:
+			s.dir(sub.entry, sub.relativePath, depth+1, childMatcher, sub.counted, childAncestors)
+		}
+	}
+}
+
+// follow returns what the symlink at path points to, or nil when it is
+// broken or leads to one of the ancestors it was found under, which would
+// make the walk loop.
+func follow(path string, ancestors []string) fs.FileInfo {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if !info.IsDir() {
+		return info
+	}
+	for _, ancestor := range ancestors {
+		if ancestorInfo, err := os.Stat(ancestor); err == nil && os.SameFile(info, ancestorInfo) {
+			return nil
+		}
+	}
+	return info
+}
+
+func (s *scanner) fail(relativePath string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, pathError{relativePath, err})
+}
+
+// firstError returns the error that a sequential walk would have met first.
+func (s *scanner) firstError() error {
+	if len(s.errs) == 0 {
+		return nil
+	}
+	first := s.errs[0]
+	for _, e := range s.errs[1:] {
+		if walksBefore(e.relativePath, first.relativePath) {
+			first = e
+		}
+	}
+	return first.err
+}
+
+// walksBefore reports whether a depth-first walk in name order visits the
+// relative path a before b.
+func walksBefore(a, b string) bool {
+	as := strings.Split(a, string(filepath.Separator))
+	bs := strings.Split(b, string(filepath.Separator))
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// sizeCounter totals the sizes of the files below a directory at the depth
+// limit, which may be read by several goroutines.
+type sizeCounter struct {
+	mu    sync.Mutex
+	entry *Entry
+}
+
+func (c *sizeCounter) add(size int64) {
+	c.mu.Lock()
+	c.entry.Size += size
+	c.mu.Unlock()
+}
+
+// prune drops the directories below dir, at depth, that end up empty.
+func prune(dir *Entry, depth, maxDepth int) {
+	kept := dir.Children[:0]
+	for _, entry := range dir.Children {
+		if entry.IsDir() {
+			if maxDepth > 0 && depth+1 >= maxDepth {
+				kept = append(kept, entry)
+				continue
+			}
+			prune(entry, depth+1, maxDepth)
+			if len(entry.Children) == 0 {
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+	dir.Children = kept
+}
+
+// addSizes adds the sizes of the entries below dir to its own.
+func addSizes(dir *Entry) {
+	for _, entry := range dir.Children {
+		addSizes(entry)
+		dir.Size += entry.Size
+	}
+}
+
+// skip reports whether the entry at relativePath should be left out. It only
+// needs the name and kind of the entry, so skipped entries are never stat'd.
+func (opts ScanOptions) skip(relativePath string, d fs.DirEntry, matcher *ignore.Matcher) bool {
+	name := d.Name()
+	if !d.IsDir() && (opts.DirsOnly || (len(opts.Patterns) > 0 && !matchAny(opts.Patterns, name, name))) {
+		return true
+	}
+	slashPath := filepath.ToSlash(relativePath)
+	if matchAny(opts.Include, name, slashPath) {
+		return false
+	}
+	if !opts.ShowHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	if opts.Ignore && (name == ".git" || matcher.Match(slashPath, d.IsDir())) {
+		return true
+	}
+	return matchAny(opts.Exclude, name, slashPath)
+}
+
+// matchAny reports whether name or slashPath matches one of the globs.
+func matchAny(patterns []string, name, slashPath string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, slashPath); matched {
+			return true
+		}
+	}
+	return false
+}
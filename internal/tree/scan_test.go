@@ -0,0 +1,297 @@
+package tree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// scanPaths returns the slash-separated paths Scan keeps, in walk order.
+func scanPaths(t *testing.T, rootDir string, opts ScanOptions) []string {
+	t.Helper()
+	root, err := Scan(rootDir, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var paths []string
+	walkEntries(root.Children, 0, func(entry *Entry, depth int) {
+		relativePath, _ := filepath.Rel(rootDir, entry.Path)
+		paths = append(paths, filepath.ToSlash(relativePath))
+	})
+	return paths
+}
+
+// TestScan_Ignore tests that ignore files are honoured at every level.
+func TestScan_Ignore(t *testing.T) {
+	rootDir := t.TempDir()
+	files := map[string]string{
+		".gitignore":              "node_modules/\n*.log\n!keep.log\n/build\n",
+		".mkprojignore":           "*.env\n",
+		".git/HEAD":               "ref: refs/heads/main\n",
+		".git/info/exclude":       "local/\n",
+		"node_modules/x/index.js": "",
+		"build/out":               "",
+		"src/build/keep.go":       "",
+		"src/.gitignore":          "gen/\n!debug.log\n",
+		"src/gen/types.go":        "",
+		"src/main.go":             "",
+		"src/debug.log":           "",
+		"local/notes.txt":         "",
+		"debug.log":               "",
+		"keep.log":                "",
+		"secret.env":              "",
+	}
+	for path, content := range files {
+		writeTestFile(t, filepath.Join(rootDir, path), content)
+	}
+
+	tests := []struct {
+		name     string
+		opts     ScanOptions
+		expected []string
+	}{
+		{
+			"Ignore files",
+			ScanOptions{Ignore: true},
+			[]string{"keep.log", "src", "src/build", "src/build/keep.go", "src/debug.log", "src/main.go"},
+		},
+		{
+			"Hidden files are still listed, but not .git",
+			ScanOptions{Ignore: true, ShowHidden: true},
+			[]string{".gitignore", ".mkprojignore", "keep.log", "src", "src/.gitignore", "src/build", "src/build/keep.go", "src/debug.log", "src/main.go"},
+		},
+		{
+			"Include overrides ignore and exclude",
+			ScanOptions{Ignore: true, Include: []string{"build", "*.env"}, Exclude: []string{"src/build", "keep.log"}},
+			[]string{"build", "build/out", "secret.env", "src", "src/build", "src/build/keep.go", "src/debug.log", "src/main.go"},
+		},
+		{
+			"Without ignore",
+			ScanOptions{Exclude: []string{"node_modules", "src"}},
+			[]string{"build", "build/out", "debug.log", "keep.log", "local", "local/notes.txt", "secret.env"},
+		},
+	}
+
+	for _, test := range tests {
+		if paths := scanPaths(t, rootDir, test.opts); !reflect.DeepEqual(paths, test.expected) {
+			t.Errorf("%s: Scan() = %q; want %q", test.name, paths, test.expected)
+		}
+	}
+}
+
+// TestScan_Limits tests depth limiting, directory-only listing, pruning and file patterns.
+func TestScan_Limits(t *testing.T) {
+	rootDir := t.TempDir()
+	for _, path := range []string{"a/b/c/x.go", "a/y.md", "g/z.txt", "README"} {
+		writeTestFile(t, filepath.Join(rootDir, path), "")
+	}
+	if err := os.MkdirAll(filepath.Join(rootDir, "e", "f"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     ScanOptions
+		expected []string
+	}{
+		{"Depth 1", ScanOptions{MaxDepth: 1}, []string{"README", "a", "e", "g"}},
+		{"Depth 2", ScanOptions{MaxDepth: 2}, []string{"README", "a", "a/b", "a/y.md", "e", "e/f", "g", "g/z.txt"}},
+		{"Directories only", ScanOptions{DirsOnly: true}, []string{"a", "a/b", "a/b/c", "e", "e/f", "g"}},
+		{"Prune", ScanOptions{Prune: true}, []string{"README", "a", "a/b", "a/b/c", "a/b/c/x.go", "a/y.md", "g", "g/z.txt"}},
+		{"Pattern", ScanOptions{Patterns: []string{"*.go", "*.md"}}, []string{"a", "a/b", "a/b/c", "a/b/c/x.go", "a/y.md", "e", "e/f", "g"}},
+		{"Pattern and prune", ScanOptions{Patterns: []string{"*.go"}, Prune: true}, []string{"a", "a/b", "a/b/c", "a/b/c/x.go"}},
+		{"Prune keeps directories at the depth limit", ScanOptions{Prune: true, MaxDepth: 2}, []string{"README", "a", "a/b", "a/y.md", "e", "e/f", "g", "g/z.txt"}},
+		{"Directories only, pruned", ScanOptions{DirsOnly: true, Prune: true}, nil},
+	}
+
+	for _, test := range tests {
+		if paths := scanPaths(t, rootDir, test.opts); !reflect.DeepEqual(paths, test.expected) {
+			t.Errorf("%s: Scan() = %q; want %q", test.name, paths, test.expected)
+		}
+	}
+}
+
+// TestScan_DepthStopsWalk tests that directories below the depth limit are never read.
+func TestScan_DepthStopsWalk(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+	rootDir := t.TempDir()
+	locked := filepath.Join(rootDir, "a", "locked")
+	writeTestFile(t, filepath.Join(locked, "secret"), "")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatalf("Failed to lock directory: %v", err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	if _, err := Scan(rootDir, ScanOptions{}); err == nil {
+		t.Fatalf("Expected reading the locked directory to fail")
+	}
+	if paths := scanPaths(t, rootDir, ScanOptions{MaxDepth: 2}); !reflect.DeepEqual(paths, []string{"a", "a/locked"}) {
+		t.Errorf("Scan() = %q; want %q", paths, []string{"a", "a/locked"})
+	}
+}
+
+// setupWideTree creates width directories of width subdirectories, each
+// holding files files, and returns its root.
+func setupWideTree(tb testing.TB, width, files int) string {
+	tb.Helper()
+	rootDir := tb.TempDir()
+	for i := 0; i < width; i++ {
+		for j := 0; j < width; j++ {
+			dir := filepath.Join(rootDir, fmt.Sprintf("dir%02d", i), fmt.Sprintf("sub%02d", j))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				tb.Fatalf("Failed to create directory: %v", err)
+			}
+			for k := 0; k < files; k++ {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%02d.go", k)), nil, 0644); err != nil {
+					tb.Fatalf("Failed to write file: %v", err)
+				}
+			}
+		}
+	}
+	return rootDir
+}
+
+// TestScan_FollowSymlinks tests that followed links are listed in place and
+// that links leading back to an ancestor are not followed.
+func TestScan_FollowSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	rootDir := t.TempDir()
+	writeTestFile(t, filepath.Join(rootDir, "a", "file"), "")
+	writeTestFile(t, filepath.Join(rootDir, "b", "file"), "")
+	symlinkTestFile(t, "../b", filepath.Join(rootDir, "a", "to-b"))
+	symlinkTestFile(t, "../a", filepath.Join(rootDir, "b", "to-a"))
+	symlinkTestFile(t, "..", filepath.Join(rootDir, "a", "up"))
+	symlinkTestFile(t, ".", filepath.Join(rootDir, "self"))
+
+	expected := []string{
+		"a", "a/file",
+		"a/to-b", "a/to-b/file", "a/to-b/to-a",
+		"a/up",
+		"b", "b/file",
+		"b/to-a", "b/to-a/file", "b/to-a/to-b", "b/to-a/up",
+		"self",
+	}
+	if got := scanPaths(t, rootDir, ScanOptions{FollowSymlinks: true}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Scan = %q; want %q", got, expected)
+	}
+
+	root, err := Scan(rootDir, ScanOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kinds := map[string]string{}
+	walkEntries(root.Children, 0, func(entry *Entry, depth int) {
+		relativePath, _ := filepath.Rel(rootDir, entry.Path)
+		kind := "file"
+		if entry.IsSymlink() {
+			kind = "link"
+		} else if entry.IsDir() {
+			kind = "dir"
+		}
+		kinds[filepath.ToSlash(relativePath)] = kind + " " + entry.Target
+	})
+	for path, want := range map[string]string{"a/to-b": "dir ../b", "a/to-b/to-a": "link ../a", "a/up": "link ..", "self": "link ."} {
+		if kinds[path] != want {
+			t.Errorf("%s = %q; want %q", path, kinds[path], want)
+		}
+	}
+}
+
+// TestScan_Deterministic tests that concurrent scans list entries in the same sorted order.
+func TestScan_Deterministic(t *testing.T) {
+	rootDir := setupWideTree(t, 8, 5)
+	expected := scanPaths(t, rootDir, ScanOptions{Workers: 1})
+	if len(expected) != 8+8*8+8*8*5 {
+		t.Fatalf("Scan() found %d entries; want %d", len(expected), 8+8*8+8*8*5)
+	}
+	if !sort.StringsAreSorted(expected) {
+		t.Errorf("Scan() entries are not sorted: %q", expected)
+	}
+	for i := 0; i < 10; i++ {
+		if paths := scanPaths(t, rootDir, ScanOptions{Workers: 64}); !reflect.DeepEqual(paths, expected) {
+			t.Fatalf("Scan() with 64 workers = %q; want %q", paths, expected)
+		}
+	}
+}
+
+// TestWalksBefore tests the order used to pick the first error.
+func TestWalksBefore(t *testing.T) {
+	sep := string(filepath.Separator)
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"a", "b", true},
+		{"a", "a" + sep + "b", true},
+		{"a" + sep + "z", "a-b", true},
+		{"a-b", "a" + sep + "z", false},
+		{"b", "a" + sep + "z", false},
+		{"a", "a", false},
+	}
+	for _, test := range tests {
+		if got := walksBefore(test.a, test.b); got != test.expected {
+			t.Errorf("walksBefore(%q, %q) = %t; want %t", test.a, test.b, got, test.expected)
+		}
+	}
+}
+
+// walkScan is the sequential filepath.Walk scan that Scan replaced, kept to
+// compare the two in benchmarks.
+func walkScan(rootDir string) (*Entry, error) {
+	info, err := os.Lstat(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	root := newEntry(rootDir, info)
+	dirs := map[string]*Entry{filepath.Clean(rootDir): root}
+	err = filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == rootDir {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		entry := newEntry(path, info)
+		parent := dirs[filepath.Dir(path)]
+		parent.Children = append(parent.Children, entry)
+		if info.IsDir() {
+			dirs[path] = entry
+		}
+		return nil
+	})
+	return root, err
+}
+
+// BenchmarkScan measures the concurrent ReadDir scan.
+func BenchmarkScan(b *testing.B) {
+	rootDir := setupWideTree(b, 20, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Scan(rootDir, ScanOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkScan_FilepathWalk measures the sequential filepath.Walk scan on the same tree.
+func BenchmarkScan_FilepathWalk(b *testing.B) {
+	rootDir := setupWideTree(b, 20, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := walkScan(rootDir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
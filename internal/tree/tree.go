@@ -2,50 +2,55 @@ package tree
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
+
+	"github.com/jobehi/mkproj/internal/render"
+	"github.com/jobehi/mkproj/internal/spec"
 )
 
-// DisplayDirectoryTree shows the directory tree.
+// DisplayDirectoryTree shows the directory tree in the dash format, leaving
+// out ignored entries.
 func DisplayDirectoryTree(rootDir string, showHidden bool) {
-	fmt.Println("Current Directory Structure:")
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Printf("Error accessing path %s: %v\n", path, err)
-			return err
-		}
-		if path == rootDir {
-			return nil
-		}
-		relativePath, _ := filepath.Rel(rootDir, path)
-		if !showHidden {
-			// Skip hidden files and directories
-			parts := strings.Split(relativePath, string(os.PathSeparator))
-			for _, part := range parts {
-				if strings.HasPrefix(part, ".") {
-					if info.IsDir() && info.Name() == part {
-						return filepath.SkipDir
-					}
-					return nil
-				}
-			}
-		}
-		depth := strings.Count(relativePath, string(os.PathSeparator))
-		indent := strings.Repeat("-", depth)
-		name := info.Name()
-		if info.IsDir() {
-			fmt.Printf("%s%s\n", indent, name)
-		} else {
-			if filepath.Ext(name) == "" {
-				fmt.Printf("%s%s:file\n", indent, name)
-			} else {
-				fmt.Printf("%s%s\n", indent, name)
-			}
-		}
-		return nil
-	})
+	opts := DisplayOptions{ScanOptions: ScanOptions{ShowHidden: showHidden, Ignore: true}}
+	err := Display(os.Stdout, rootDir, FormatDash, opts)
 	if err != nil {
 		fmt.Printf("Error displaying directory tree: %v\n", err)
 	}
 }
+
+// WriteStructure writes rootDir to w in the structure format, one entry per
+// line, so that `mkproj create` rebuilds the same tree. Entries whose name
+// cannot be written in the format are reported as an error.
+func WriteStructure(w io.Writer, rootDir string, opts ScanOptions) error {
+	return Write(w, rootDir, FormatDash, DisplayOptions{ScanOptions: opts})
+}
+
+// formatEntry renders entry as a structure line at depth, followed by the
+// attributes of files and directories. Literal "{{" is escaped because `create`
+// renders template variables before parsing. Followed symlinks are written as
+// what they point to.
+func formatEntry(entry *Entry, depth int, attrs spec.Attributes) (string, bool) {
+	if !spec.CanFormat(entry.Name) {
+		return "", false
+	}
+	if entry.IsSymlink() {
+		if !spec.CanFormatTarget(entry.Target) {
+			return "", false
+		}
+		return render.Escape(spec.FormatLink(depth, entry.Name, entry.Target)), true
+	}
+	kind := spec.Dir
+	if !entry.IsDir() {
+		kind = spec.File
+	}
+	return render.Escape(spec.FormatLine(depth, entry.Name, kind) + attrs.Format()), true
+}
+
+// walkEntries calls fn for every entry in depth-first order.
+func walkEntries(entries []*Entry, depth int, fn func(entry *Entry, depth int)) {
+	for _, entry := range entries {
+		fn(entry, depth)
+		walkEntries(entry.Children, depth+1, fn)
+	}
+}
@@ -27,7 +27,7 @@ func captureOutput(f func()) string {
 	return buf.String()
 }
 
-// TestDisplayDirectoryTree_EmptyDirectory tests that an empty directory outputs nothing after "Current Directory Structure:"
+// TestDisplayDirectoryTree_EmptyDirectory tests that an empty directory outputs nothing
 func TestDisplayDirectoryTree_EmptyDirectory(t *testing.T) {
 	// Setup: Create a temporary empty directory
 	rootDir := setupEmptyTestDirectory(t)
@@ -39,7 +39,7 @@ func TestDisplayDirectoryTree_EmptyDirectory(t *testing.T) {
 	})
 
 	// Expected directory structure output for an empty directory
-	expected := "Current Directory Structure:"
+	expected := ""
 
 	if strings.TrimSpace(output) != strings.TrimSpace(expected) {
 		t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)